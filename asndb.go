@@ -0,0 +1,286 @@
+package ipv4
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ASNInfo is the autonomous system an address is routed to
+type ASNInfo struct {
+	ASN     uint32
+	Country string // ISO 3166 country code, empty if unknown
+	Name    string // AS name or description
+}
+
+func (a *ASNInfo) String() string {
+	s := fmt.Sprintf("AS%d", a.ASN)
+	if a.Name != "" {
+		s += " " + a.Name
+	}
+	if a.Country != "" {
+		s += " (" + a.Country + ")"
+	}
+	return s
+}
+
+// ASNDB maps addresses to the AS announcing them.  The interval values
+// are *ASNInfo, shared by all ranges of an AS.
+//
+//	db := ipv4.NewASNDB()
+//	err := db.LoadIP2ASN(f)
+//	info, ok := db.LookupDots("1.1.1.1")
+type ASNDB struct {
+	m     *IntervalMap
+	infos map[uint32]*ASNInfo
+}
+
+// ASNStats summarizes an ASNDB
+type ASNStats struct {
+	Intervals int
+	ASNs      int
+	Addresses uint64 // addresses with an ASN
+
+	// Coverage is the fraction of the globally routable space (see
+	// IsGlobal) that has an ASN
+	Coverage float64
+}
+
+// NewASNDB creates an empty ASNDB
+func NewASNDB() *ASNDB {
+	return &ASNDB{
+		m:     NewIntervalMap(0),
+		infos: make(map[uint32]*ASNInfo),
+	}
+}
+
+// info returns the shared ASNInfo of an AS, filling in the country and
+// name if they were not known yet
+func (db *ASNDB) info(asn uint32, country, name string) *ASNInfo {
+	a := db.infos[asn]
+	if a == nil {
+		a = &ASNInfo{ASN: asn}
+		db.infos[asn] = a
+	}
+	if a.Country == "" {
+		a.Country = country
+	}
+	if a.Name == "" {
+		a.Name = name
+	}
+	return a
+}
+
+// LoadIP2ASN reads the ip2asn TSV format of iptoasn.com, with dotted or
+// integer bounds:
+//
+//	1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET
+//	1.0.4.0	1.0.7.255	38803	AU	WPL-AS-AP Wirefreebroadband Pty Ltd
+//	1.0.8.0	1.0.15.255	0	None	Not routed
+//
+// Unrouted ranges (AS 0) and IPv6 rows are skipped.  Ranges already in
+// the database are kept where the two overlap.
+func (db *ASNDB) LoadIP2ASN(r io.Reader) error {
+	loaded := NewIntervalMap(0)
+	loader := CSVLoader{Comma: '\t', LazyQuotes: true, Network: -1, Start: 0, End: 1}
+	err := loader.Read(r, func(left, right uint32, row []string) error {
+		if len(row) < 3 {
+			return fmt.Errorf("missing AS number")
+		}
+		asn, err := strconv.ParseUint(strings.TrimSpace(row[2]), 10, 32)
+		if err != nil {
+			return fmt.Errorf("bad AS number %q", row[2])
+		}
+		if asn == 0 {
+			return nil
+		}
+		var country, name string
+		if len(row) > 3 {
+			country = strings.TrimSpace(row[3])
+			if country == "None" {
+				country = ""
+			}
+		}
+		if len(row) > 4 {
+			name = strings.TrimSpace(row[4])
+		}
+		return loaded.insert(left, right, db.info(uint32(asn), country, name))
+	})
+	if err != nil {
+		return err
+	}
+	return db.overlay(loaded)
+}
+
+// LoadPfx2AS reads the CAIDA RouteViews prefix to AS format:
+//
+//	1.0.0.0	24	13335
+//	1.0.4.0	22	38803
+//	1.0.16.0	24	2519_4826
+//
+// Nested prefixes are resolved by longest match.  For multi-origin
+// prefixes ("_" or "," separated) the first AS is used.  Ranges already
+// in the database are kept where the two overlap, so names and countries
+// can come from an ip2asn file loaded first.
+func (db *ASNDB) LoadPfx2AS(r io.Reader) error {
+	table := NewPrefixTable()
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0][0] == '#' {
+			continue
+		}
+		if strings.IndexByte(fields[0], ':') != -1 {
+			continue
+		}
+		if len(fields) < 3 {
+			return &LineError{Line: line, Err: fmt.Errorf("expected 3 fields, got %d", len(fields))}
+		}
+		p, err := ParsePrefix(fields[0] + "/" + fields[1])
+		if err != nil {
+			return &LineError{Line: line, Err: err}
+		}
+		origin := fields[2]
+		if pos := strings.IndexAny(origin, "_,"); pos != -1 {
+			origin = origin[:pos]
+		}
+		asn, err := strconv.ParseUint(origin, 10, 32)
+		if err != nil {
+			return &LineError{Line: line, Err: fmt.Errorf("bad AS number %q", fields[2])}
+		}
+		table.Insert(p, db.info(uint32(asn), "", ""))
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return db.overlay(table.Flatten())
+}
+
+// overlay adds the intervals of m that are not already covered.  On
+// error the database is left as it was.
+func (db *ASNDB) overlay(m *IntervalMap) error {
+	base := db.m.Intervals
+	if len(base) == 0 {
+		db.m = m
+		return nil
+	}
+	out := NewIntervalMap(len(base) + len(m.Intervals))
+	i := 0
+	for _, iv := range m.Intervals {
+		left := uint64(iv.Left)
+		for left <= uint64(iv.Right) {
+			// copy the base intervals before left
+			for i < len(base) && uint64(base[i].Right) < left {
+				if err := out.insert(base[i].Left, base[i].Right, base[i].Value); err != nil {
+					return err
+				}
+				i++
+			}
+			if i < len(base) && uint64(base[i].Left) <= left {
+				// covered, skip to the end of the base interval
+				left = uint64(base[i].Right) + 1
+				continue
+			}
+			right := uint64(iv.Right)
+			if i < len(base) && uint64(base[i].Left) <= right {
+				right = uint64(base[i].Left) - 1
+			}
+			if err := out.insert(uint32(left), uint32(right), iv.Value); err != nil {
+				return err
+			}
+			left = right + 1
+		}
+	}
+	for ; i < len(base); i++ {
+		if err := out.insert(base[i].Left, base[i].Right, base[i].Value); err != nil {
+			return err
+		}
+	}
+	db.m = out
+	return nil
+}
+
+// Lookup returns the AS of an address
+func (db *ASNDB) Lookup(addr uint32) (ASNInfo, bool) {
+	if a, ok := db.m.lookup(addr).(*ASNInfo); ok {
+		return *a, true
+	}
+	return ASNInfo{}, false
+}
+
+// LookupDots is Lookup for dotted addresses
+func (db *ASNDB) LookupDots(dots string) (ASNInfo, bool) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return ASNInfo{}, false
+	}
+	return db.Lookup(addr)
+}
+
+// Prefixes returns the CIDRs routed to an AS, in address order
+func (db *ASNDB) Prefixes(asn uint32) []string {
+	var out []string
+	for _, iv := range db.m.Intervals {
+		if a, ok := iv.Value.(*ASNInfo); ok && a.ASN == asn {
+			Interval2CIDRs(iv.Left, iv.Right, func(left uint32, bits byte) {
+				out = append(out, fmt.Sprintf("%s/%d", ToDots(left), bits))
+			})
+		}
+	}
+	return out
+}
+
+// IntervalMap returns the underlying map, with *ASNInfo values
+func (db *ASNDB) IntervalMap() *IntervalMap {
+	return db.m
+}
+
+// Stats returns the size and coverage of the database
+func (db *ASNDB) Stats() ASNStats {
+	stats := ASNStats{Intervals: db.m.Len()}
+	asns := make(map[uint32]bool)
+	var global uint64
+	special := outerSpecialPurpose()
+	for _, iv := range db.m.Intervals {
+		if a, ok := iv.Value.(*ASNInfo); ok {
+			asns[a.ASN] = true
+		}
+		size := uint64(iv.Right) - uint64(iv.Left) + 1
+		stats.Addresses += size
+		global += size
+		for _, s := range special {
+			if s.Left <= iv.Right && iv.Left <= s.Right {
+				lo, hi := s.Left, s.Right
+				if iv.Left > lo {
+					lo = iv.Left
+				}
+				if iv.Right < hi {
+					hi = iv.Right
+				}
+				global -= uint64(hi) - uint64(lo) + 1
+			}
+		}
+	}
+	stats.ASNs = len(asns)
+
+	space := uint64(1) << 32
+	for _, s := range special {
+		space -= uint64(s.Right) - uint64(s.Left) + 1
+	}
+	stats.Coverage = float64(global) / float64(space)
+	return stats
+}
+
+// outerSpecialPurpose returns the special-purpose blocks that are not
+// inside another, sorted
+func outerSpecialPurpose() []Range {
+	var out []Range
+	for _, block := range specialPurpose {
+		out = append(out, Range{block.left, block.right})
+	}
+	return mergeRanges(out)
+}
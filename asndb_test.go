@@ -0,0 +1,181 @@
+package ipv4
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testIP2ASN = "0.0.0.0\t0.255.255.255\t0\tNone\tNot routed\n" +
+	"1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.0.1.0\t1.0.3.255\t0\tNone\tNot routed\n" +
+	"1.0.4.0\t1.0.7.255\t38803\tAU\tWPL-AS-AP Wirefreebroadband \"Pty\" Ltd\n" +
+	"16777216\t16777471\t13335\tUS\tCLOUDFLARENET\n" +
+	"1.1.1.0\t1.1.1.255\t13335\tUS\tCLOUDFLARENET\n" +
+	"::1\t::ffff\t0\tNone\tNot routed\n" +
+	"8.0.0.0\t8.255.255.255\t3356\tUS\tLEVEL3\n"
+
+const testPfx2AS = "# comment\n" +
+	"1.0.0.0\t24\t13335\n" +
+	"1.0.4.0\t22\t38803\n" +
+	"1.0.16.0\t24\t2519_4826\n" +
+	"9.0.0.0\t8\t3356\n" +
+	"9.9.9.0\t24\t19281\n" +
+	"2001:db8::\t32\t64500\n"
+
+func TestASNDBIP2ASN(t *testing.T) {
+	db := NewASNDB()
+	if err := db.LoadIP2ASN(strings.NewReader(testIP2ASN)); err != nil {
+		t.Fatalf("LoadIP2ASN failed: %s", err)
+	}
+	cases := []struct {
+		dots string
+		want string
+	}{
+		{"1.0.0.1", "AS13335 CLOUDFLARENET (US)"},
+		{"1.0.5.5", `AS38803 WPL-AS-AP Wirefreebroadband "Pty" Ltd (AU)`},
+		{"1.1.1.1", "AS13335 CLOUDFLARENET (US)"},
+		{"8.8.8.8", "AS3356 LEVEL3 (US)"},
+		{"0.1.2.3", ""},
+		{"1.0.2.0", ""},
+		{"junk", ""},
+	}
+	for _, c := range cases {
+		info, ok := db.LookupDots(c.dots)
+		got := ""
+		if ok {
+			got = info.String()
+		}
+		if got != c.want {
+			t.Errorf("LookupDots(%s) = %q, want %q", c.dots, got, c.want)
+		}
+	}
+
+	want := []string{"1.0.0.0/24", "1.1.1.0/24"}
+	if got := db.Prefixes(13335); !reflect.DeepEqual(got, want) {
+		t.Errorf("Prefixes(13335) = %v, want %v", got, want)
+	}
+	if got := db.Prefixes(64500); got != nil {
+		t.Errorf("Prefixes(64500) = %v", got)
+	}
+
+	stats := db.Stats()
+	if stats.Intervals != 4 || stats.ASNs != 3 || stats.Addresses != 256+1024+256+1<<24 {
+		t.Errorf("Stats = %+v", stats)
+	}
+	if stats.Coverage < 0.004 || stats.Coverage > 0.005 {
+		t.Errorf("Coverage = %f", stats.Coverage)
+	}
+	if db.IntervalMap().Len() != 4 {
+		t.Errorf("IntervalMap().Len() = %d", db.IntervalMap().Len())
+	}
+
+	bad := []string{
+		"1.0.0.0\t1.0.0.255\n",
+		"1.0.0.0\t1.0.0.255\tAS13335\tUS\tX\n",
+		"1.0.0.255\t1.0.0.0\t13335\tUS\tX\n",
+	}
+	for _, b := range bad {
+		if err := NewASNDB().LoadIP2ASN(strings.NewReader(b)); err == nil {
+			t.Errorf("Expected error on %q", b)
+		}
+	}
+}
+
+func TestASNDBPfx2AS(t *testing.T) {
+	db := NewASNDB()
+	if err := db.LoadPfx2AS(strings.NewReader(testPfx2AS)); err != nil {
+		t.Fatalf("LoadPfx2AS failed: %s", err)
+	}
+	cases := []struct {
+		dots string
+		asn  uint32
+	}{
+		{"1.0.0.1", 13335},
+		{"1.0.16.1", 2519},
+		{"9.1.1.1", 3356},
+		{"9.9.9.9", 19281},
+		{"9.9.10.1", 3356},
+		{"1.0.8.1", 0},
+	}
+	for _, c := range cases {
+		info, _ := db.LookupDots(c.dots)
+		if info.ASN != c.asn {
+			t.Errorf("LookupDots(%s) = %d, want %d", c.dots, info.ASN, c.asn)
+		}
+	}
+	want := []string{"9.0.0.0/13", "9.8.0.0/16", "9.9.0.0/21", "9.9.8.0/24", "9.9.10.0/23",
+		"9.9.12.0/22", "9.9.16.0/20", "9.9.32.0/19", "9.9.64.0/18", "9.9.128.0/17",
+		"9.10.0.0/15", "9.12.0.0/14", "9.16.0.0/12", "9.32.0.0/11", "9.64.0.0/10", "9.128.0.0/9"}
+	if got := db.Prefixes(3356); !reflect.DeepEqual(got, want) {
+		t.Errorf("Prefixes(3356) = %v, want %v", got, want)
+	}
+
+	bad := []string{"1.0.0.0\t24\n", "1.0.0.0\t33\t1\n", "1.0.0.0\t24\tAS1\n"}
+	for _, b := range bad {
+		err := NewASNDB().LoadPfx2AS(strings.NewReader(b))
+		if lerr, ok := err.(*LineError); !ok || lerr.Line != 1 {
+			t.Errorf("LoadPfx2AS(%q) = %v, want a line error", b, err)
+		}
+	}
+}
+
+func TestASNDBCombined(t *testing.T) {
+	// names from ip2asn, gaps filled from pfx2as
+	db := NewASNDB()
+	if err := db.LoadIP2ASN(strings.NewReader(testIP2ASN)); err != nil {
+		t.Fatalf("LoadIP2ASN failed: %s", err)
+	}
+	if err := db.LoadPfx2AS(strings.NewReader(testPfx2AS)); err != nil {
+		t.Fatalf("LoadPfx2AS failed: %s", err)
+	}
+	cases := []struct {
+		dots string
+		want string
+	}{
+		{"1.0.0.1", "AS13335 CLOUDFLARENET (US)"},
+		{"1.0.16.1", "AS2519"},
+		{"8.8.8.8", "AS3356 LEVEL3 (US)"},
+		{"9.9.9.9", "AS19281"},
+		{"9.1.1.1", "AS3356 LEVEL3 (US)"},
+	}
+	for _, c := range cases {
+		info, _ := db.LookupDots(c.dots)
+		if got := info.String(); got != c.want {
+			t.Errorf("LookupDots(%s) = %q, want %q", c.dots, got, c.want)
+		}
+	}
+	if err := db.IntervalMap().Valid(); err != nil {
+		t.Errorf("map is not valid: %s", err)
+	}
+	// 8.0.0.0/8 and the start of 9.0.0.0/8 are merged
+	if stats := db.Stats(); stats.ASNs != 5 || stats.Intervals != 7 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+func TestASNDBWholeSpace(t *testing.T) {
+	db := NewASNDB()
+	if err := db.LoadIP2ASN(strings.NewReader("1.0.0.0\t1.0.0.255\t13335\tUS\tCLOUDFLARENET\n")); err != nil {
+		t.Fatalf("LoadIP2ASN failed: %s", err)
+	}
+	if err := db.LoadPfx2AS(strings.NewReader("0.0.0.0\t0\t64500\n")); err != nil {
+		t.Fatalf("LoadPfx2AS failed: %s", err)
+	}
+	if err := db.IntervalMap().Valid(); err != nil {
+		t.Errorf("map is not valid: %s", err)
+	}
+	if info, _ := db.LookupDots("255.1.1.1"); info.String() != "AS64500" {
+		t.Errorf("LookupDots(255.1.1.1) = %q", info)
+	}
+
+	// a failed merge is reported and leaves the database alone
+	bad := &IntervalMap{Intervals: IntervalList{{Left: 5, Right: 1}}}
+	db.m = bad
+	if err := db.LoadPfx2AS(strings.NewReader("10.0.0.0\t8\t64500\n")); err == nil {
+		t.Errorf("Expected error merging into a corrupt map")
+	}
+	if db.m != bad {
+		t.Errorf("database changed after a failed merge")
+	}
+}
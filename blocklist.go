@@ -0,0 +1,193 @@
+package ipv4
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// BlocklistEntry is a single network read from a blocklist
+type BlocklistEntry struct {
+	Line  int
+	Left  uint32
+	Right uint32
+
+	// Annotation is any text attached to the entry, such as the SBL id
+	// in Spamhaus DROP lists or an ipset comment
+	Annotation string
+}
+
+// ReadBlocklist parses a plain text blocklist, calling fn for each entry.
+//
+// It understands the common feed formats:
+//
+//	; Spamhaus DROP comment
+//	1.10.16.0/20 ; SBL256894
+//	# FireHOL comment
+//	1.2.3.4
+//	10.0.0.1 - 10.0.0.50
+//	create blocklist hash:net family inet hashsize 1024 maxelem 65536
+//	add blocklist 5.6.7.0/24 timeout 0 comment "scanner"
+//
+// Lines that can not be parsed do not stop reading, they are returned as
+// diagnostics.  The error is from reading or from fn.
+func ReadBlocklist(r io.Reader, fn func(BlocklistEntry) error) ([]*LineError, error) {
+	var diags []*LineError
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\uFEFF")
+		}
+		entry, ok, err := parseBlocklistLine(text)
+		if err != nil {
+			diags = append(diags, &LineError{Line: line, Err: err})
+			continue
+		}
+		if !ok {
+			continue
+		}
+		entry.Line = line
+		if err := fn(entry); err != nil {
+			return diags, &LineError{Line: line, Err: err}
+		}
+	}
+	return diags, scanner.Err()
+}
+
+// LoadBlocklist reads a blocklist into an IntervalMap.  Each interval's
+// value is the entry's annotation, or def for entries without one.
+func LoadBlocklist(r io.Reader, m *IntervalMap, def interface{}) ([]*LineError, error) {
+	return ReadBlocklist(r, func(e BlocklistEntry) error {
+		var value = def
+		if e.Annotation != "" {
+			value = e.Annotation
+		}
+		return m.insert(e.Left, e.Right, value)
+	})
+}
+
+// LoadBlocklistSet reads a blocklist into a Set, expanding each entry
+// into its addresses.  Like Set.AddAll it stops expanding after
+// maxSetExpansion addresses; entries that would go over are returned as
+// diagnostics.
+func LoadBlocklistSet(r io.Reader, s *Set) ([]*LineError, error) {
+	var skipped []*LineError
+	budget := uint64(maxSetExpansion)
+	in := *s
+	diags, err := ReadBlocklist(r, func(e BlocklistEntry) error {
+		size := uint64(e.Right) - uint64(e.Left) + 1
+		if size > budget {
+			skipped = append(skipped, &LineError{Line: e.Line,
+				Err: fmt.Errorf("%s-%s is over the limit of %d addresses", ToDots(e.Left), ToDots(e.Right), maxSetExpansion)})
+			return nil
+		}
+		budget -= size
+		for x := e.Left; ; x++ {
+			in = append(in, x)
+			if x == e.Right {
+				break
+			}
+		}
+		return nil
+	})
+	*s = in
+	s.sort()
+	if len(skipped) > 0 {
+		diags = append(diags, skipped...)
+		sort.SliceStable(diags, func(i, j int) bool { return diags[i].Line < diags[j].Line })
+	}
+	return diags, err
+}
+
+// parseBlocklistLine returns false for lines without an entry
+func parseBlocklistLine(text string) (BlocklistEntry, bool, error) {
+	entry := BlocklistEntry{}
+	text = strings.TrimSpace(text)
+	if text == "" || text[0] == ';' || text[0] == '#' {
+		return entry, false, nil
+	}
+
+	fields := strings.Fields(text)
+	switch fields[0] {
+	case "create", "flush", "destroy", "swap", "rename":
+		// ipset commands without addresses
+		return entry, false, nil
+	case "add", "-A":
+		// ipset "add setname entry [options]"
+		if len(fields) < 3 {
+			return entry, false, fmt.Errorf("ipset line without an entry: %q", text)
+		}
+		if pos := strings.Index(text, " comment "); pos != -1 {
+			entry.Annotation = strings.Trim(strings.TrimSpace(text[pos+len(" comment "):]), `"`)
+		}
+		text = fields[2]
+	}
+
+	// "cidr ; annotation" and trailing "# comment"
+	if pos := strings.IndexByte(text, ';'); pos != -1 {
+		entry.Annotation = strings.TrimSpace(text[pos+1:])
+		text = text[:pos]
+	}
+	if pos := strings.IndexByte(text, '#'); pos != -1 {
+		text = text[:pos]
+	}
+	fields = strings.Fields(text)
+	if len(fields) == 0 {
+		return entry, false, fmt.Errorf("no address in %q", text)
+	}
+
+	// ranges written "a - b", "a -b", "a- b" or "a-b"
+	spec, rest := fields[0], fields[1:]
+	switch {
+	case len(rest) >= 2 && rest[0] == "-":
+		spec, rest = spec+"-"+rest[1], rest[2:]
+	case len(rest) >= 1 && (strings.HasSuffix(spec, "-") || strings.HasPrefix(rest[0], "-")):
+		spec, rest = spec+rest[0], rest[1:]
+	}
+	if len(rest) > 0 && entry.Annotation == "" {
+		entry.Annotation = strings.Join(rest, " ")
+	}
+
+	var err error
+	entry.Left, entry.Right, err = parseBlocklistSpec(spec)
+	if err != nil {
+		return entry, false, err
+	}
+	return entry, true, nil
+}
+
+// parseBlocklistSpec parses a bare IP, CIDR or "a-b" range
+func parseBlocklistSpec(spec string) (uint32, uint32, error) {
+	if pos := strings.IndexByte(spec, '-'); pos != -1 {
+		left, err := FromDots(spec[:pos])
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unable to parse %q", spec)
+		}
+		right, err := FromDots(spec[pos+1:])
+		if err != nil {
+			return 0, 0, fmt.Errorf("Unable to parse %q", spec)
+		}
+		if left > right {
+			return 0, 0, fmt.Errorf("left %s > right %s", ToDots(left), ToDots(right))
+		}
+		return left, right, nil
+	}
+	if strings.IndexByte(spec, '/') != -1 {
+		return cidrBounds(spec)
+	}
+	addr, err := FromDots(spec)
+	if err != nil {
+		if strings.IndexByte(spec, ':') != -1 {
+			return 0, 0, errors.New("IPv6 entries are not supported")
+		}
+		return 0, 0, fmt.Errorf("Unable to parse %q", spec)
+	}
+	return addr, addr, nil
+}
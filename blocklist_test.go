@@ -0,0 +1,127 @@
+package ipv4
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadBlocklist(t *testing.T) {
+	in := "\uFEFF; Spamhaus DROP List 2020/09/30\r\n" +
+		"; https://www.spamhaus.org/drop/drop.txt\n" +
+		"1.10.16.0/20 ; SBL256894\n" +
+		"# FireHOL level1\n" +
+		"\n" +
+		"2.56.192.0/22\n" +
+		"5.6.7.8   # inline comment\n" +
+		"10.0.0.1 - 10.0.0.50\n" +
+		"10.1.0.1-10.1.0.9 scanners\n" +
+		"10.2.0.1 -10.2.0.9\n" +
+		"create blocklist hash:net family inet hashsize 1024 maxelem 65536\n" +
+		"add blocklist 5.6.8.0/24 timeout 0 comment \"bad actor\"\n" +
+		"add blocklist 5.6.9.0/24\n" +
+		"2001:db8::1\n" +
+		"busted\n" +
+		"10.0.0.9-10.0.0.1\n" +
+		"add blocklist\n"
+
+	var entries []BlocklistEntry
+	diags, err := ReadBlocklist(strings.NewReader(in), func(e BlocklistEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadBlocklist failed: %s", err)
+	}
+
+	want := []struct {
+		line       int
+		left       string
+		right      string
+		annotation string
+	}{
+		{3, "1.10.16.0", "1.10.31.255", "SBL256894"},
+		{6, "2.56.192.0", "2.56.195.255", ""},
+		{7, "5.6.7.8", "5.6.7.8", ""},
+		{8, "10.0.0.1", "10.0.0.50", ""},
+		{9, "10.1.0.1", "10.1.0.9", "scanners"},
+		{10, "10.2.0.1", "10.2.0.9", ""},
+		{12, "5.6.8.0", "5.6.8.255", "bad actor"},
+		{13, "5.6.9.0", "5.6.9.255", ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("Got %d entries, want %d: %v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Line != w.line || ToDots(e.Left) != w.left || ToDots(e.Right) != w.right || e.Annotation != w.annotation {
+			t.Errorf("entry %d = %d [%s, %s] %q, want %d [%s, %s] %q", i,
+				e.Line, ToDots(e.Left), ToDots(e.Right), e.Annotation,
+				w.line, w.left, w.right, w.annotation)
+		}
+	}
+
+	wantDiags := []int{14, 15, 16, 17}
+	if len(diags) != len(wantDiags) {
+		t.Fatalf("Got %d diagnostics, want %d: %v", len(diags), len(wantDiags), diags)
+	}
+	for i, line := range wantDiags {
+		if diags[i].Line != line {
+			t.Errorf("diagnostic %d on line %d, want %d: %s", i, diags[i].Line, line, diags[i])
+		}
+	}
+}
+
+func TestLoadBlocklist(t *testing.T) {
+	in := "1.10.16.0/20 ; SBL256894\n1.10.32.0/24\n1.10.33.0/24\n"
+	m := NewIntervalMap(10)
+	diags, err := LoadBlocklist(strings.NewReader(in), m, true)
+	if err != nil || len(diags) != 0 {
+		t.Fatalf("LoadBlocklist failed: %v %v", err, diags)
+	}
+	if m.Len() != 2 {
+		t.Errorf("Expected 2 intervals, got %d:\n%s", m.Len(), m)
+	}
+	if m.Contains("1.10.17.1") != "SBL256894" || m.Contains("1.10.33.1") != true {
+		t.Errorf("Unexpected values:\n%s", m)
+	}
+
+	// a later entry inside the whole space
+	m = NewIntervalMap(10)
+	diags, err = LoadBlocklist(strings.NewReader("0.0.0.0/0 all\n10.0.0.0/8 ten\n"), m, true)
+	if err != nil || len(diags) != 0 {
+		t.Errorf("LoadBlocklist failed: %v %v", err, diags)
+	}
+	if err := m.Valid(); err != nil {
+		t.Errorf("Valid failed: %s", err)
+	}
+}
+
+func TestLoadBlocklistSet(t *testing.T) {
+	in := "# x\n10.0.0.1 - 10.0.0.3\n10.0.0.2\n0.0.0.0/0\nbusted\n192.168.0.0/31\n"
+	s := Set{}
+	diags, err := LoadBlocklistSet(strings.NewReader(in), &s)
+	if err != nil {
+		t.Fatalf("LoadBlocklistSet failed: %s", err)
+	}
+	if len(diags) != 2 || diags[0].Line != 4 || diags[1].Line != 5 {
+		t.Errorf("Unexpected diagnostics %v", diags)
+	}
+	if got := strings.Join(s.ToDots(), " "); got != "10.0.0.1 10.0.0.2 10.0.0.3 192.168.0.0 192.168.0.1" {
+		t.Errorf("LoadBlocklistSet = %s", got)
+	}
+	if !s.Valid() {
+		t.Errorf("Set is not sorted and unique")
+	}
+}
+
+func TestReadBlocklistCallbackError(t *testing.T) {
+	stop := errors.New("stop")
+	_, err := ReadBlocklist(strings.NewReader("# x\n1.2.3.4\n5.6.7.8\n"), func(e BlocklistEntry) error {
+		return stop
+	})
+	lerr, ok := err.(*LineError)
+	if !ok || lerr.Line != 2 || lerr.Err != stop {
+		t.Errorf("Expected error on line 2, got %v", err)
+	}
+}
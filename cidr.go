@@ -75,3 +75,17 @@ func Interval2CIDRs(a1, a2 uint32, out func(left uint32, mask byte)) {
 		a1++
 	}
 }
+
+// cidrBounds returns the first and last address of a CIDR as uint32
+func cidrBounds(c string) (uint32, uint32, error) {
+	_, ipnet, err := net.ParseCIDR(c)
+	if err != nil {
+		return 0, 0, err
+	}
+	left, err := FromNetIP(ipnet.IP)
+	if err != nil {
+		return 0, 0, err
+	}
+	ones, _ := ipnet.Mask.Size()
+	return left, left | uint32(uint64(1)<<uint(32-ones)-1), nil
+}
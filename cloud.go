@@ -0,0 +1,252 @@
+package ipv4
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// CloudRange is the value of a cloud provider network
+type CloudRange struct {
+	Provider string // "aws", "gcp", "azure", "cloudflare" or "fastly"
+	Service  string // such as "EC2", "Google Cloud" or "Storage"
+	Region   string // such as "us-east-1", empty if global
+}
+
+func (c CloudRange) String() string {
+	s := c.Provider
+	if c.Service != "" {
+		s += "/" + c.Service
+	}
+	if c.Region != "" {
+		s += "/" + c.Region
+	}
+	return s
+}
+
+// genericCloudServices are the catch-all services that list every range
+// of a provider, which lose to any more specific service for the same
+// prefix
+var genericCloudServices = map[string]bool{
+	"AMAZON":     true,
+	"AzureCloud": true,
+}
+
+// rank orders entries for the same prefix, higher wins
+func (c CloudRange) rank() int {
+	r := 0
+	if c.Service != "" && !genericCloudServices[c.Service] {
+		r += 2
+	}
+	if c.Region != "" {
+		r++
+	}
+	return r
+}
+
+// CloudRanges collects the published address ranges of cloud providers
+// from locally saved copies of their range files:
+//
+//	c := ipv4.NewCloudRanges()
+//	err := c.LoadAWS(f) // ip-ranges.json
+//	...
+//	m := c.IntervalMap()
+//	if v, ok := m.Contains(dots).(ipv4.CloudRange); ok {
+//		...
+//	}
+//
+// Overlaps are resolved most specific first: an EC2 /24 inside an AMAZON
+// /16 is EC2.  Where the same prefix is listed more than once, a named
+// service beats a generic one such as AMAZON or AzureCloud, and an entry
+// with a region beats one without.
+type CloudRanges struct {
+	table *PrefixTable
+}
+
+// NewCloudRanges creates an empty CloudRanges
+func NewCloudRanges() *CloudRanges {
+	return &CloudRanges{table: NewPrefixTable()}
+}
+
+// Add adds a CIDR, IPv6 CIDRs are ignored
+func (c *CloudRanges) Add(cidr string, value CloudRange) error {
+	cidr = strings.TrimSpace(cidr)
+	if strings.IndexByte(cidr, ':') != -1 {
+		return nil
+	}
+	p, err := ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	if old, ok := c.table.Get(p); ok {
+		if prev, isCloud := old.(CloudRange); isCloud && prev.rank() >= value.rank() {
+			return nil
+		}
+	}
+	c.table.Insert(p, value)
+	return nil
+}
+
+// Len returns the number of prefixes
+func (c *CloudRanges) Len() int {
+	return c.table.Len()
+}
+
+// Table returns the prefixes with their CloudRange values
+func (c *CloudRanges) Table() *PrefixTable {
+	return c.table
+}
+
+// IntervalMap flattens the ranges into an IntervalMap of CloudRange
+// values
+func (c *CloudRanges) IntervalMap() *IntervalMap {
+	return c.table.Flatten()
+}
+
+// LoadAWS reads AWS ip-ranges.json
+func (c *CloudRanges) LoadAWS(r io.Reader) error {
+	var doc struct {
+		Prefixes []struct {
+			IPPrefix string `json:"ip_prefix"`
+			Region   string `json:"region"`
+			Service  string `json:"service"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("AWS ranges: %v", err)
+	}
+	for _, p := range doc.Prefixes {
+		region := p.Region
+		if region == "GLOBAL" {
+			region = ""
+		}
+		if err := c.Add(p.IPPrefix, CloudRange{"aws", p.Service, region}); err != nil {
+			return fmt.Errorf("AWS ranges: %v", err)
+		}
+	}
+	return nil
+}
+
+// LoadGCP reads Google Cloud's cloud.json
+func (c *CloudRanges) LoadGCP(r io.Reader) error {
+	var doc struct {
+		Prefixes []struct {
+			IPv4Prefix string `json:"ipv4Prefix"`
+			Service    string `json:"service"`
+			Scope      string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("GCP ranges: %v", err)
+	}
+	for _, p := range doc.Prefixes {
+		if p.IPv4Prefix == "" {
+			continue
+		}
+		if err := c.Add(p.IPv4Prefix, CloudRange{"gcp", p.Service, p.Scope}); err != nil {
+			return fmt.Errorf("GCP ranges: %v", err)
+		}
+	}
+	return nil
+}
+
+// LoadAzure reads an Azure Service Tags file such as
+// ServiceTags_Public.json.  The service is the tag's system service, or
+// the tag name without its region ("AzureCloud" for
+// "AzureCloud.eastus").
+func (c *CloudRanges) LoadAzure(r io.Reader) error {
+	var doc struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region          string   `json:"region"`
+				SystemService   string   `json:"systemService"`
+				AddressPrefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return fmt.Errorf("Azure ranges: %v", err)
+	}
+	for _, v := range doc.Values {
+		service := v.Properties.SystemService
+		if service == "" {
+			service = v.Name
+			if pos := strings.IndexByte(service, '.'); pos != -1 {
+				service = service[:pos]
+			}
+		}
+		value := CloudRange{"azure", service, v.Properties.Region}
+		for _, p := range v.Properties.AddressPrefixes {
+			if err := c.Add(p, value); err != nil {
+				return fmt.Errorf("Azure ranges: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadCloudflare reads Cloudflare's ips-v4 text list or the JSON of its
+// /ips API
+func (c *CloudRanges) LoadCloudflare(r io.Reader) error {
+	var doc struct {
+		Result struct {
+			IPv4CIDRs []string `json:"ipv4_cidrs"`
+		} `json:"result"`
+	}
+	cidrs, err := readCloudList(r, &doc, func() []string { return doc.Result.IPv4CIDRs })
+	if err != nil {
+		return fmt.Errorf("Cloudflare ranges: %v", err)
+	}
+	return c.addList(cidrs, CloudRange{Provider: "cloudflare"})
+}
+
+// LoadFastly reads the JSON of Fastly's public-ip-list API or a text
+// list
+func (c *CloudRanges) LoadFastly(r io.Reader) error {
+	var doc struct {
+		Addresses []string `json:"addresses"`
+	}
+	cidrs, err := readCloudList(r, &doc, func() []string { return doc.Addresses })
+	if err != nil {
+		return fmt.Errorf("Fastly ranges: %v", err)
+	}
+	return c.addList(cidrs, CloudRange{Provider: "fastly"})
+}
+
+func (c *CloudRanges) addList(cidrs []string, value CloudRange) error {
+	for _, cidr := range cidrs {
+		if err := c.Add(cidr, value); err != nil {
+			return fmt.Errorf("%s ranges: %v", value.Provider, err)
+		}
+	}
+	return nil
+}
+
+// readCloudList reads either JSON into doc, returning list(), or a text
+// file of one CIDR per line with "#" comments
+func readCloudList(r io.Reader, doc interface{}, list func() []string) ([]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, doc); err != nil {
+			return nil, err
+		}
+		return list(), nil
+	}
+	var cidrs []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && line[0] != '#' {
+			cidrs = append(cidrs, line)
+		}
+	}
+	return cidrs, scanner.Err()
+}
@@ -0,0 +1,141 @@
+package ipv4
+
+import (
+	"strings"
+	"testing"
+)
+
+const testAWSRanges = `{
+  "syncToken": "1700000000",
+  "createDate": "2023-11-14-22-13-20",
+  "prefixes": [
+    {"ip_prefix": "3.5.0.0/16", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"},
+    {"ip_prefix": "3.5.1.0/24", "region": "us-east-1", "service": "EC2", "network_border_group": "us-east-1"},
+    {"ip_prefix": "3.5.2.0/24", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"},
+    {"ip_prefix": "3.5.2.0/24", "region": "us-east-1", "service": "S3", "network_border_group": "us-east-1"},
+    {"ip_prefix": "3.5.3.0/24", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f00::/24", "region": "us-east-1", "service": "AMAZON", "network_border_group": "us-east-1"}
+  ]
+}`
+
+const testGCPRanges = `{
+  "syncToken": "1700000000",
+  "creationTime": "2023-11-14T22:13:20",
+  "prefixes": [
+    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv6Prefix": "2600:1900::/35", "service": "Google Cloud", "scope": "us-central1"}
+  ]
+}`
+
+const testAzureServiceTags = `{
+  "changeNumber": 1,
+  "cloud": "Public",
+  "values": [
+    {"name": "AzureCloud", "id": "AzureCloud", "properties": {"region": "", "systemService": "", "addressPrefixes": ["20.0.0.0/16", "2603:1000::/24"]}},
+    {"name": "AzureCloud.eastus", "id": "AzureCloud.eastus", "properties": {"region": "eastus", "systemService": "", "addressPrefixes": ["20.0.1.0/24"]}},
+    {"name": "Storage.EastUS", "id": "Storage.EastUS", "properties": {"region": "eastus", "systemService": "AzureStorage", "addressPrefixes": ["20.0.1.0/24"]}}
+  ]
+}`
+
+const testCloudflareText = "# ips-v4\n173.245.48.0/20\n\n103.21.244.0/22\n"
+
+const testCloudflareJSON = `{"result": {"ipv4_cidrs": ["173.245.48.0/20"], "ipv6_cidrs": ["2400:cb00::/32"], "etag": "x"}, "success": true, "errors": [], "messages": []}`
+
+const testFastlyJSON = `{"addresses": ["23.235.32.0/20"], "ipv6_addresses": ["2a04:4e40::/32"]}`
+
+func TestCloudRanges(t *testing.T) {
+	c := NewCloudRanges()
+	loads := []struct {
+		name string
+		fn   func(r *strings.Reader) error
+		data string
+	}{
+		{"aws", func(r *strings.Reader) error { return c.LoadAWS(r) }, testAWSRanges},
+		{"gcp", func(r *strings.Reader) error { return c.LoadGCP(r) }, testGCPRanges},
+		{"azure", func(r *strings.Reader) error { return c.LoadAzure(r) }, testAzureServiceTags},
+		{"cloudflare", func(r *strings.Reader) error { return c.LoadCloudflare(r) }, testCloudflareText},
+		{"fastly", func(r *strings.Reader) error { return c.LoadFastly(r) }, testFastlyJSON},
+	}
+	for _, l := range loads {
+		if err := l.fn(strings.NewReader(l.data)); err != nil {
+			t.Fatalf("loading %s failed: %s", l.name, err)
+		}
+	}
+	if c.Len() != 10 {
+		t.Errorf("expected 10 prefixes, got %d", c.Len())
+	}
+
+	m := c.IntervalMap()
+	if err := m.Valid(); err != nil {
+		t.Fatalf("invalid map: %s", err)
+	}
+	cases := []struct {
+		dots string
+		want string
+	}{
+		{"3.5.0.1", "aws/AMAZON/us-east-1"},
+		{"3.5.1.1", "aws/EC2/us-east-1"},
+		{"3.5.2.1", "aws/S3/us-east-1"},
+		{"3.5.3.1", "aws/CLOUDFRONT"},
+		{"3.5.4.1", "aws/AMAZON/us-east-1"},
+		{"34.1.210.1", "gcp/Google Cloud/africa-south1"},
+		{"20.0.0.1", "azure/AzureCloud"},
+		{"20.0.1.1", "azure/AzureStorage/eastus"},
+		{"173.245.50.1", "cloudflare"},
+		{"103.21.244.1", "cloudflare"},
+		{"23.235.40.1", "fastly"},
+		{"8.8.8.8", ""},
+	}
+	for _, tt := range cases {
+		got := ""
+		if v, ok := m.Contains(tt.dots).(CloudRange); ok {
+			got = v.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.dots, tt.want, got)
+		}
+	}
+}
+
+func TestCloudRangesTies(t *testing.T) {
+	// the generic service loses whichever order the entries come in
+	c := NewCloudRanges()
+	c.Add("3.5.2.0/24", CloudRange{"aws", "S3", "us-east-1"})
+	c.Add("3.5.2.0/24", CloudRange{"aws", "AMAZON", "us-east-1"})
+	c.Add("2600::/16", CloudRange{"aws", "AMAZON", ""})
+	_, v, ok := c.Table().LongestMatch(0x03050201)
+	if !ok || v.(CloudRange).Service != "S3" {
+		t.Errorf("expected S3, got %v", v)
+	}
+	if c.Len() != 1 {
+		t.Errorf("IPv6 prefix was not skipped, %d prefixes", c.Len())
+	}
+}
+
+func TestCloudRangesCloudflareJSON(t *testing.T) {
+	c := NewCloudRanges()
+	if err := c.LoadCloudflare(strings.NewReader(testCloudflareJSON)); err != nil {
+		t.Fatalf("LoadCloudflare failed: %s", err)
+	}
+	if v := c.IntervalMap().Contains("173.245.48.1"); v != (CloudRange{Provider: "cloudflare"}) {
+		t.Errorf("expected cloudflare, got %v", v)
+	}
+	if c.Len() != 1 {
+		t.Errorf("expected 1 prefix, got %d", c.Len())
+	}
+}
+
+func TestCloudRangesErrors(t *testing.T) {
+	c := NewCloudRanges()
+	if err := c.LoadAWS(strings.NewReader("{")); err == nil {
+		t.Errorf("expected error for truncated JSON")
+	}
+	if err := c.LoadFastly(strings.NewReader("23.235.32.0/20\nnot-a-cidr\n")); err == nil {
+		t.Errorf("expected error for bad CIDR")
+	}
+	if err := c.LoadAWS(strings.NewReader(`{"prefixes": [{"ip_prefix": "3.5.0.0/33"}]}`)); err == nil {
+		t.Errorf("expected error for bad prefix")
+	}
+}
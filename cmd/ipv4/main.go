@@ -0,0 +1,480 @@
+// Command ipv4 works with IPv4 addresses, ranges and CIDRs from the
+// shell:
+//
+//	ipv4 cidr2range 10.0.0.0/8
+//	ipv4 range2cidr 10.0.0.1-10.0.0.50
+//	ipv4 aggregate blocklist.txt
+//	ipv4 exclude -x allowlist.txt blocklist.txt
+//	ipv4 contains blocklist.txt 10.1.2.3
+//	ipv4 classify 100.64.0.1
+//	sort access.ips | ipv4 sort-uniq
+//	ipv4 convert -to hex 10.0.0.1
+//
+// Commands taking addresses read them from the arguments, or from stdin
+// one per line if there are none.  Commands taking files read stdin if
+// none are given or for "-".  Lists may hold addresses, CIDRs, ranges and
+// comments in any format understood by ipv4.ReadBlocklist.
+//
+// Every command takes -json to write JSON instead of text.  The exit
+// status is 0 on success, 1 if contains finds an address that is not in
+// the list and 2 for bad usage or input.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/signalsciences/ipv4"
+)
+
+// exit statuses
+const (
+	exitOK    = 0
+	exitFalse = 1
+	exitError = 2
+)
+
+// cli is the state of one run
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	status int
+
+	// flags
+	json    bool
+	exclude string
+	to      string
+}
+
+type command struct {
+	args  string
+	help  string
+	flags func(fs *flag.FlagSet, c *cli)
+	run   func(c *cli, args []string) error
+}
+
+var commands = map[string]command{
+	"cidr2range": {"[CIDR...]", "print the first and last address of each CIDR", nil, cidr2range},
+	"range2cidr": {"[FIRST-LAST...] | FIRST LAST", "print the CIDRs of ranges", nil, range2cidr},
+	"aggregate":  {"[FILE...]", "merge lists into the minimal list of CIDRs", nil, aggregate},
+	"exclude": {"-x FILE [FILE...]", "merge lists and remove the networks in -x", func(fs *flag.FlagSet, c *cli) {
+		fs.StringVar(&c.exclude, "x", "", "list of networks to remove")
+	}, exclude},
+	"contains":  {"LIST [IP...]", "report whether each address is in the list", nil, contains},
+	"classify":  {"[IP...]", "print the special-purpose class of addresses, or global", nil, classify},
+	"sort-uniq": {"[FILE...]", "sort addresses and remove duplicates", nil, sortUniq},
+	"convert": {"[-to dots|int|hex] [IP...]", "convert addresses between dotted, integer and hex", func(fs *flag.FlagSet, c *cli) {
+		fs.StringVar(&c.to, "to", "", "output only this form")
+	}, convert},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitError
+	}
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		usage(stdout)
+		return exitOK
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(stderr, "ipv4: unknown command %q\n", name)
+		usage(stderr)
+		return exitError
+	}
+
+	c := &cli{stdin: stdin, stdout: stdout}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: ipv4 %s [-json] %s\n", name, cmd.args)
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&c.json, "json", false, "write JSON")
+	if cmd.flags != nil {
+		cmd.flags(fs, c)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitError
+	}
+	if err := cmd.run(c, fs.Args()); err != nil {
+		fmt.Fprintf(stderr, "ipv4 %s: %s\n", name, err)
+		return exitError
+	}
+	return c.status
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: ipv4 COMMAND [-json] [ARGS]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-11s %s\n", name, commands[name].help)
+	}
+}
+
+// items returns the arguments, or the lines of stdin without blanks and
+// comments
+func (c *cli) items(args []string) ([]string, error) {
+	if len(args) > 0 {
+		return args, nil
+	}
+	var items []string
+	scanner := bufio.NewScanner(c.stdin)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text != "" && text[0] != '#' {
+			items = append(items, text)
+		}
+	}
+	return items, scanner.Err()
+}
+
+// open calls fn with each file, stdin for "-" or no files
+func (c *cli) open(files []string, fn func(name string, r io.Reader) error) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		if name == "-" {
+			if err := fn("stdin", c.stdin); err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		err = fn(name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRanges reads lists of networks, returning their union
+func (c *cli) readRanges(files []string) ([]ipv4.Range, error) {
+	var ranges []ipv4.Range
+	err := c.open(files, func(name string, r io.Reader) error {
+		diags, err := ipv4.ReadBlocklist(r, func(e ipv4.BlocklistEntry) error {
+			ranges = append(ranges, ipv4.Range{Left: e.Left, Right: e.Right})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if len(diags) > 0 {
+			return fmt.Errorf("%s: %s", name, diags[0])
+		}
+		return nil
+	})
+	return union(ranges), err
+}
+
+// union sorts and merges overlapping and adjacent ranges
+func union(ranges []ipv4.Range) []ipv4.Range {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Left < ranges[j].Left })
+	out := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &out[len(out)-1]
+		if last.Right == 0xFFFFFFFF || r.Left <= last.Right+1 {
+			if r.Right > last.Right {
+				last.Right = r.Right
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// subtract removes the ranges of b from a, both as returned by union
+func subtract(a, b []ipv4.Range) []ipv4.Range {
+	var out []ipv4.Range
+	j := 0
+	for _, r := range a {
+		for j < len(b) && b[j].Right < r.Left {
+			j++
+		}
+		left := uint64(r.Left)
+		for k := j; k < len(b) && b[k].Left <= r.Right; k++ {
+			if uint64(b[k].Left) > left {
+				out = append(out, ipv4.Range{Left: uint32(left), Right: b[k].Left - 1})
+			}
+			left = uint64(b[k].Right) + 1
+		}
+		if left <= uint64(r.Right) {
+			out = append(out, ipv4.Range{Left: uint32(left), Right: r.Right})
+		}
+	}
+	return out
+}
+
+// cidrs returns the minimal CIDRs of the ranges
+func cidrs(ranges []ipv4.Range) []string {
+	var out []string
+	for _, r := range ranges {
+		out = append(out, r.CIDRs()...)
+	}
+	return out
+}
+
+// writeList writes strings one per line, or as a JSON array
+func (c *cli) writeList(list []string) error {
+	if c.json {
+		if list == nil {
+			list = []string{}
+		}
+		return json.NewEncoder(c.stdout).Encode(list)
+	}
+	w := bufio.NewWriter(c.stdout)
+	for _, s := range list {
+		fmt.Fprintln(w, s)
+	}
+	return w.Flush()
+}
+
+// writeRecords writes JSON objects as an array, or the text lines
+func (c *cli) writeRecords(records []interface{}, lines []string) error {
+	if c.json {
+		if records == nil {
+			records = []interface{}{}
+		}
+		return json.NewEncoder(c.stdout).Encode(records)
+	}
+	return c.writeList(lines)
+}
+
+func parseAddr(s string) (uint32, error) {
+	addr, err := ipv4.FromDots(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return addr, nil
+}
+
+func cidr2range(c *cli, args []string) error {
+	items, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	type record struct {
+		CIDR  string `json:"cidr"`
+		First string `json:"first"`
+		Last  string `json:"last"`
+	}
+	var records []interface{}
+	var lines []string
+	for _, item := range items {
+		first, last, err := ipv4.CIDR2Range(item)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q", item)
+		}
+		records = append(records, record{item, first, last})
+		lines = append(lines, first+" "+last)
+	}
+	return c.writeRecords(records, lines)
+}
+
+func range2cidr(c *cli, args []string) error {
+	items, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 2 && !strings.Contains(args[0], "-") && !strings.Contains(args[1], "-") {
+		items = []string{args[0] + "-" + args[1]}
+	}
+	var out []string
+	for _, item := range items {
+		ranges, err := ipv4.ParseRangeSpec(item, ipv4.RangeLenient)
+		if err != nil {
+			return err
+		}
+		out = append(out, cidrs(ranges)...)
+	}
+	return c.writeList(out)
+}
+
+func aggregate(c *cli, args []string) error {
+	ranges, err := c.readRanges(args)
+	if err != nil {
+		return err
+	}
+	return c.writeList(cidrs(ranges))
+}
+
+func exclude(c *cli, args []string) error {
+	if c.exclude == "" {
+		return errors.New("-x is required")
+	}
+	remove, err := c.readRanges([]string{c.exclude})
+	if err != nil {
+		return err
+	}
+	ranges, err := c.readRanges(args)
+	if err != nil {
+		return err
+	}
+	return c.writeList(cidrs(subtract(ranges, remove)))
+}
+
+func contains(c *cli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("a list file is required")
+	}
+	list, err := c.readRanges(args[:1])
+	if err != nil {
+		return err
+	}
+	items, err := c.items(args[1:])
+	if err != nil {
+		return err
+	}
+	type record struct {
+		IP       string `json:"ip"`
+		Contains bool   `json:"contains"`
+	}
+	var records []interface{}
+	var lines []string
+	for _, item := range items {
+		addr, err := parseAddr(item)
+		if err != nil {
+			return err
+		}
+		i := sort.Search(len(list), func(i int) bool { return list[i].Right >= addr })
+		found := i < len(list) && list[i].Left <= addr
+		if !found {
+			c.status = exitFalse
+		}
+		records = append(records, record{item, found})
+		lines = append(lines, fmt.Sprintf("%s\t%t", item, found))
+	}
+	return c.writeRecords(records, lines)
+}
+
+func classify(c *cli, args []string) error {
+	items, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	type record struct {
+		IP      string `json:"ip"`
+		Class   string `json:"class"`
+		Private bool   `json:"private"`
+		Global  bool   `json:"global"`
+	}
+	var records []interface{}
+	var lines []string
+	for _, item := range items {
+		addr, err := parseAddr(item)
+		if err != nil {
+			return err
+		}
+		class, special := ipv4.SpecialPurpose(addr)
+		if !special {
+			class = "global"
+		}
+		records = append(records, record{item, class, ipv4.IsPrivate(item), !special})
+		lines = append(lines, item+"\t"+class)
+	}
+	return c.writeRecords(records, lines)
+}
+
+func sortUniq(c *cli, args []string) error {
+	var addrs []uint32
+	err := c.open(args, func(name string, r io.Reader) error {
+		scanner := bufio.NewScanner(r)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || text[0] == '#' {
+				continue
+			}
+			addr, err := parseAddr(text)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s", name, line, err)
+			}
+			addrs = append(addrs, addr)
+		}
+		return scanner.Err()
+	})
+	if err != nil {
+		return err
+	}
+	set := ipv4.Set(addrs)
+	sort.Sort(set)
+	var out []string
+	for i, addr := range set {
+		if i > 0 && addr == set[i-1] {
+			continue
+		}
+		out = append(out, ipv4.ToDots(addr))
+	}
+	return c.writeList(out)
+}
+
+func convert(c *cli, args []string) error {
+	switch c.to {
+	case "", "dots", "int", "hex":
+	default:
+		return fmt.Errorf("-to must be dots, int or hex, not %q", c.to)
+	}
+	items, err := c.items(args)
+	if err != nil {
+		return err
+	}
+	type record struct {
+		Input string `json:"input"`
+		Dots  string `json:"dots"`
+		Int   uint32 `json:"int"`
+		Hex   string `json:"hex"`
+	}
+	var records []interface{}
+	var lines []string
+	for _, item := range items {
+		addr, form, err := ipv4.ParseLegacy(item)
+		if err != nil || form&ipv4.LegacyTrailing != 0 {
+			return fmt.Errorf("invalid address %q", item)
+		}
+		r := record{item, ipv4.ToDots(addr), addr, fmt.Sprintf("0x%08x", addr)}
+		records = append(records, r)
+		switch c.to {
+		case "dots":
+			lines = append(lines, r.Dots)
+		case "int":
+			lines = append(lines, fmt.Sprint(r.Int))
+		case "hex":
+			lines = append(lines, r.Hex)
+		default:
+			lines = append(lines, fmt.Sprintf("%s %d %s", r.Dots, r.Int, r.Hex))
+		}
+	}
+	return c.writeRecords(records, lines)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/signalsciences/ipv4"
+)
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		args   string
+		stdin  string
+		status int
+		want   string
+	}{
+		{"cidr2range 10.0.0.0/30 192.168.0.0/16", "", 0,
+			"10.0.0.0 10.0.0.3\n192.168.0.0 192.168.255.255\n"},
+		{"cidr2range -json", "10.0.0.0/31\n", 0,
+			`[{"cidr":"10.0.0.0/31","first":"10.0.0.0","last":"10.0.0.1"}]` + "\n"},
+		{"cidr2range 10.0.0.0/33", "", 2, ""},
+		{"range2cidr 10.0.0.1 10.0.0.6", "", 0,
+			"10.0.0.1/32\n10.0.0.2/31\n10.0.0.4/31\n10.0.0.6/32\n"},
+		{"range2cidr", "10.0.0.0-10.0.0.255\n10.1.0.0 - 10.1.0.1\n", 0,
+			"10.0.0.0/24\n10.1.0.0/31\n"},
+		{"aggregate testdata/list.txt", "", 0,
+			"10.0.0.0/23\n10.0.3.5/32\n192.0.2.0/29\n192.0.2.8/31\n"},
+		{"aggregate -json - testdata/list.txt", "10.0.2.0/24\n", 0,
+			`["10.0.0.0/23","10.0.2.0/24","10.0.3.5/32","192.0.2.0/29","192.0.2.8/31"]` + "\n"},
+		{"aggregate", "not an address\n", 2, ""},
+		{"exclude -x - testdata/list.txt", "10.0.0.128/25\n192.0.2.0/24\n", 0,
+			"10.0.0.0/25\n10.0.1.0/24\n10.0.3.5/32\n"},
+		{"exclude testdata/list.txt", "", 2, ""},
+		{"contains testdata/list.txt 10.0.1.1 192.0.2.9", "", 0,
+			"10.0.1.1\ttrue\n192.0.2.9\ttrue\n"},
+		{"contains testdata/list.txt", "10.0.1.1\n10.0.2.1\n", 1,
+			"10.0.1.1\ttrue\n10.0.2.1\tfalse\n"},
+		{"contains -json testdata/list.txt 10.0.2.1", "", 1,
+			`[{"ip":"10.0.2.1","contains":false}]` + "\n"},
+		{"contains testdata/missing.txt 10.0.1.1", "", 2, ""},
+		{"contains", "", 2, ""},
+		{"classify 100.64.0.1 8.8.8.8 127.0.0.1 169.254.169.254", "", 0,
+			"100.64.0.1\tshared\n8.8.8.8\tglobal\n127.0.0.1\tloopback\n169.254.169.254\tmetadata\n"},
+		{"classify -json 10.1.1.1", "", 0,
+			`[{"ip":"10.1.1.1","class":"private","private":true,"global":false}]` + "\n"},
+		{"classify 1.2.3", "", 2, ""},
+		{"sort-uniq", "3.3.3.3\n1.1.1.1\n\n3.3.3.3\n10.0.0.1\n", 0,
+			"1.1.1.1\n3.3.3.3\n10.0.0.1\n"},
+		{"sort-uniq -json", "", 0, "[]\n"},
+		{"sort-uniq", "1.1.1.1\n1.1.1\n", 2, ""},
+		{"convert 0x7f.1 167772161 10.0.0.1", "", 0,
+			"127.0.0.1 2130706433 0x7f000001\n10.0.0.1 167772161 0x0a000001\n10.0.0.1 167772161 0x0a000001\n"},
+		{"convert -to int 10.0.0.1", "", 0, "167772161\n"},
+		{"convert -to hex -json 10.0.0.1", "", 0,
+			`[{"input":"10.0.0.1","dots":"10.0.0.1","int":167772161,"hex":"0x0a000001"}]` + "\n"},
+		{"convert -to octal 10.0.0.1", "", 2, ""},
+		{"convert 10.0.0.1junk", "", 2, ""},
+		{"nope", "", 2, ""},
+		{"", "", 2, ""},
+		{"help", "", 0, ""},
+		{"aggregate -bogus", "", 2, ""},
+	}
+	for _, tt := range cases {
+		stdout := bytes.Buffer{}
+		stderr := bytes.Buffer{}
+		status := run(strings.Fields(tt.args), strings.NewReader(tt.stdin), &stdout, &stderr)
+		if status != tt.status {
+			t.Errorf("%q: expected status %d, got %d, stderr %q", tt.args, tt.status, status, stderr.String())
+			continue
+		}
+		if tt.want != "" && stdout.String() != tt.want {
+			t.Errorf("%q: expected\n%s\ngot\n%s", tt.args, tt.want, stdout.String())
+		}
+		if status == exitError && stderr.Len() == 0 && tt.args != "" {
+			t.Errorf("%q: expected a message on stderr", tt.args)
+		}
+	}
+}
+
+func TestSubtract(t *testing.T) {
+	a := union(rangesOf(0, 10, 20, 30, 40, 0xFFFFFFFF))
+	b := union(rangesOf(0, 2, 5, 5, 9, 25, 0xFFFFFFF0, 0xFFFFFFFF))
+	got := subtract(a, b)
+	want := rangesOf(3, 4, 6, 8, 26, 30, 40, 0xFFFFFFEF)
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("expected %v, got %v", want, got)
+			break
+		}
+	}
+}
+
+func rangesOf(bounds ...uint32) []ipv4.Range {
+	var out []ipv4.Range
+	for i := 0; i+1 < len(bounds); i += 2 {
+		out = append(out, ipv4.Range{Left: bounds[i], Right: bounds[i+1]})
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+// Code generated by ipv4gen from countries.txt; DO NOT EDIT.
+
+package example
+
+import (
+	"sort"
+
+	"github.com/signalsciences/ipv4"
+)
+
+// Countries has 3 intervals with string values
+var Countries = &ipv4.IntervalMap{
+	Intervals: ipv4.IntervalList{
+		{Left: 0x0a000000, Right: 0x0a0001ff, Value: "US"}, // 10.0.0.0-10.0.1.255
+		{Left: 0x0a010000, Right: 0x0a01ffff, Value: "CA"}, // 10.1.0.0-10.1.255.255
+		{Left: 0xc8000000, Right: 0xc9000005, Value: "BR"}, // 200.0.0.0-201.0.0.5
+	},
+}
+
+// countriesIndex[i] is the first interval of Countries ending at or after i.0.0.0
+var countriesIndex = [257]int{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3,
+}
+
+// LookupCountries returns the value of the interval of Countries holding addr
+func LookupCountries(addr uint32) (string, bool) {
+	octet := addr >> 24
+	first, last := countriesIndex[octet], countriesIndex[octet+1]
+	if last < len(Countries.Intervals) {
+		last++
+	}
+	intervals := Countries.Intervals[first:last]
+	i := sort.Search(len(intervals), func(i int) bool { return intervals[i].Right >= addr })
+	if i < len(intervals) && intervals[i].Left <= addr {
+		return intervals[i].Value.(string), true
+	}
+	return "", false
+}
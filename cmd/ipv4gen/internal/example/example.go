@@ -0,0 +1,5 @@
+// Package example is compiled from countries.txt by ipv4gen, testing the
+// generated code
+package example
+
+//go:generate go run github.com/signalsciences/ipv4/cmd/ipv4gen -var Countries -index -o countries_gen.go countries.txt
@@ -0,0 +1,42 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/signalsciences/ipv4"
+)
+
+func TestLookupCountries(t *testing.T) {
+	cases := []struct {
+		dots string
+		want string
+	}{
+		{"9.255.255.255", ""},
+		{"10.0.0.0", "US"},
+		{"10.0.1.255", "US"},
+		{"10.0.2.0", ""},
+		{"10.1.200.1", "CA"},
+		{"200.0.0.0", "BR"},
+		{"200.255.0.1", "BR"},
+		{"201.0.0.5", "BR"},
+		{"201.0.0.6", ""},
+		{"255.255.255.255", ""},
+	}
+	if err := Countries.Valid(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range cases {
+		addr, _ := ipv4.FromDots(tt.dots)
+		got, ok := LookupCountries(addr)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("LookupCountries(%s) = %q, %v, want %q", tt.dots, got, ok, tt.want)
+		}
+		var want interface{}
+		if tt.want != "" {
+			want = tt.want
+		}
+		if v := Countries.Contains(tt.dots); v != want {
+			t.Errorf("Contains(%s) = %v, want %v", tt.dots, v, want)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+// Command ipv4gen generates Go source for an ipv4.IntervalMap compiled
+// into a program, for use with go generate:
+//
+//	//go:generate go run github.com/signalsciences/ipv4/cmd/ipv4gen -var Countries -index -o countries_gen.go countries.txt
+//
+// Inputs are lists in any format understood by ipv4.ReadBlocklist, where
+// the text after a network is its value:
+//
+//	10.0.0.0/24 US
+//	10.0.1.0 - 10.0.1.255 ; CA
+//
+// or with -csv, CSV files with the bounds in the -network column or the
+// -start and -end columns and the value in the -column column.
+//
+// Values are typed with -type, one of string, bool, int, int64, uint32,
+// uint64 or float64.  Entries without a value get -value, or true for
+// bool.
+//
+// The output is gofmt'd and has a package clause, taken from -pkg or
+// $GOPACKAGE.  With -index it also has a table of the first interval for
+// each leading octet and a typed lookup function using it.
+//
+// With -check the file named by -o is compared to what would be
+// generated, exiting with status 1 if it is out of date.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/signalsciences/ipv4"
+)
+
+// exit statuses
+const (
+	exitOK    = 0
+	exitStale = 1
+	exitError = 2
+)
+
+// generator holds the flags
+type generator struct {
+	output  string
+	check   bool
+	pkg     string
+	name    string
+	typ     string
+	value   string
+	csv     bool
+	header  bool
+	network int
+	start   int
+	end     int
+	column  int
+	index   bool
+	sources []string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command line args and returns the exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	g := &generator{}
+	fs := flag.NewFlagSet("ipv4gen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: ipv4gen [flags] FILE...\n")
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&g.output, "o", "", "output file, stdout if empty")
+	fs.BoolVar(&g.check, "check", false, "exit with status 1 if the -o file is out of date")
+	fs.StringVar(&g.pkg, "pkg", "", "package name, $GOPACKAGE if empty")
+	fs.StringVar(&g.name, "var", "Networks", "variable name")
+	fs.StringVar(&g.typ, "type", "string", "value type: string, bool, int, int64, uint32, uint64 or float64")
+	fs.StringVar(&g.value, "value", "", "value of entries without one")
+	fs.BoolVar(&g.csv, "csv", false, "read CSV files")
+	fs.BoolVar(&g.header, "header", false, "skip the first CSV row")
+	fs.IntVar(&g.network, "network", -1, "CSV column with a CIDR")
+	fs.IntVar(&g.start, "start", -1, "CSV column with the first address")
+	fs.IntVar(&g.end, "end", -1, "CSV column with the last address")
+	fs.IntVar(&g.column, "column", -1, "CSV column with the value")
+	fs.BoolVar(&g.index, "index", false, "generate a leading octet index and lookup function")
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitError
+	}
+	g.sources = fs.Args()
+
+	src, err := g.generate(stdin)
+	if err != nil {
+		fmt.Fprintf(stderr, "ipv4gen: %s\n", err)
+		return exitError
+	}
+
+	switch {
+	case g.check:
+		if g.output == "" {
+			fmt.Fprintf(stderr, "ipv4gen: -check needs -o\n")
+			return exitError
+		}
+		old, err := ioutil.ReadFile(g.output)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(stderr, "ipv4gen: %s\n", err)
+			return exitError
+		}
+		if !bytes.Equal(old, src) {
+			fmt.Fprintf(stderr, "ipv4gen: %s is out of date, run go generate\n", g.output)
+			return exitStale
+		}
+	case g.output == "":
+		if _, err := stdout.Write(src); err != nil {
+			fmt.Fprintf(stderr, "ipv4gen: %s\n", err)
+			return exitError
+		}
+	default:
+		if err := ioutil.WriteFile(g.output, src, 0644); err != nil {
+			fmt.Fprintf(stderr, "ipv4gen: %s\n", err)
+			return exitError
+		}
+	}
+	return exitOK
+}
+
+// generate returns the formatted source
+func (g *generator) generate(stdin io.Reader) ([]byte, error) {
+	if g.pkg == "" {
+		g.pkg = os.Getenv("GOPACKAGE")
+	}
+	if g.pkg == "" {
+		return nil, errors.New("no package name, use -pkg")
+	}
+	if !isIdentifier(g.pkg) || !isIdentifier(g.name) {
+		return nil, fmt.Errorf("invalid package or variable name")
+	}
+	if _, err := parseValue(g.typ, zeroValue(g.typ)); err != nil {
+		return nil, err
+	}
+	m, err := g.load(stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := bytes.Buffer{}
+	g.write(&buf, m)
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %s", err)
+	}
+	return src, nil
+}
+
+// load reads the sources into a map of typed values
+func (g *generator) load(stdin io.Reader) (*ipv4.IntervalMap, error) {
+	def := g.value
+	if def == "" && g.typ == "bool" {
+		def = "true"
+	}
+	sources := g.sources
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	m := ipv4.NewIntervalMap(1024)
+	for _, name := range sources {
+		var err error
+		if name == "-" {
+			err = g.loadOne(stdin, m, def)
+		} else {
+			var f *os.File
+			if f, err = os.Open(name); err != nil {
+				return nil, err
+			}
+			err = g.loadOne(f, m, def)
+			f.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	// type the values, merging neighbours that end up equal
+	out := ipv4.NewIntervalMap(m.Len())
+	for _, val := range m.Intervals {
+		v, err := parseValue(g.typ, val.Value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", val, err)
+		}
+		if n := len(out.Intervals); n > 0 {
+			last := &out.Intervals[n-1]
+			// stay within the interval size ipv4.IntervalMap.Valid accepts
+			if last.Right+1 == val.Left && val.Right-last.Left <= 255<<24 && last.Value == v {
+				last.Right = val.Right
+				continue
+			}
+		}
+		out.Intervals = append(out.Intervals, ipv4.Interval{Left: val.Left, Right: val.Right, Value: v})
+	}
+	return out, nil
+}
+
+func (g *generator) loadOne(r io.Reader, m *ipv4.IntervalMap, def string) error {
+	if !g.csv {
+		diags, err := ipv4.LoadBlocklist(r, m, def)
+		if err != nil {
+			return err
+		}
+		if len(diags) > 0 {
+			return diags[0]
+		}
+		return nil
+	}
+	if g.network == -1 && (g.start == -1 || g.end == -1) {
+		return errors.New("-csv needs -network or -start and -end")
+	}
+	loader := ipv4.CSVLoader{
+		SkipHeader: g.header,
+		Network:    g.network,
+		Start:      g.start,
+		End:        g.end,
+		Value: func(row []string) (interface{}, error) {
+			if g.column == -1 {
+				return def, nil
+			}
+			if g.column >= len(row) {
+				return nil, fmt.Errorf("no column %d", g.column)
+			}
+			if row[g.column] == "" {
+				return def, nil
+			}
+			return row[g.column], nil
+		},
+	}
+	return loader.Load(r, m)
+}
+
+// write writes the unformatted source
+func (g *generator) write(w *bytes.Buffer, m *ipv4.IntervalMap) {
+	from := make([]string, len(g.sources))
+	for i, name := range g.sources {
+		from[i] = filepath.Base(name)
+	}
+	if len(from) == 0 {
+		from = []string{"stdin"}
+	}
+	fmt.Fprintf(w, "// Code generated by ipv4gen from %s; DO NOT EDIT.\n\n", strings.Join(from, ", "))
+	fmt.Fprintf(w, "package %s\n\n", g.pkg)
+	if g.index {
+		fmt.Fprintf(w, "import (\n\"sort\"\n\n\"github.com/signalsciences/ipv4\"\n)\n\n")
+	} else {
+		fmt.Fprintf(w, "import \"github.com/signalsciences/ipv4\"\n\n")
+	}
+
+	fmt.Fprintf(w, "// %s has %d intervals with %s values\n", g.name, m.Len(), g.typ)
+	fmt.Fprintf(w, "var %s = &ipv4.IntervalMap{\nIntervals: ipv4.IntervalList{\n", g.name)
+	for _, val := range m.Intervals {
+		fmt.Fprintf(w, "{Left: 0x%08x, Right: 0x%08x, Value: %s}, // %s-%s\n",
+			val.Left, val.Right, goValue(g.typ, val.Value), ipv4.ToDots(val.Left), ipv4.ToDots(val.Right))
+	}
+	fmt.Fprintf(w, "},\n}\n")
+
+	if g.index {
+		g.writeIndex(w, m)
+	}
+}
+
+// writeIndex writes the first interval for each leading octet and a
+// lookup function searching only the intervals of the octet
+func (g *generator) writeIndex(w *bytes.Buffer, m *ipv4.IntervalMap) {
+	index := octetIndex(m)
+	exported := unicode.IsUpper([]rune(g.name)[0])
+	indexName := lowerFirst(g.name) + "Index"
+	lookupName := "lookup" + upperFirst(g.name)
+	if exported {
+		lookupName = "Lookup" + g.name
+	}
+
+	fmt.Fprintf(w, "\n// %s[i] is the first interval of %s ending at or after i.0.0.0\n", indexName, g.name)
+	fmt.Fprintf(w, "var %s = [257]int{", indexName)
+	for i, v := range index {
+		if i%16 == 0 {
+			fmt.Fprintf(w, "\n")
+		}
+		fmt.Fprintf(w, "%d, ", v)
+	}
+	fmt.Fprintf(w, "\n}\n")
+
+	fmt.Fprintf(w, "\n// %s returns the value of the interval of %s holding addr\n", lookupName, g.name)
+	fmt.Fprintf(w, "func %s(addr uint32) (%s, bool) {\n", lookupName, g.typ)
+	fmt.Fprintf(w, "octet := addr >> 24\n")
+	fmt.Fprintf(w, "first, last := %s[octet], %s[octet+1]\n", indexName, indexName)
+	fmt.Fprintf(w, "if last < len(%s.Intervals) {\nlast++\n}\n", g.name)
+	fmt.Fprintf(w, "intervals := %s.Intervals[first:last]\n", g.name)
+	fmt.Fprintf(w, "i := sort.Search(len(intervals), func(i int) bool { return intervals[i].Right >= addr })\n")
+	fmt.Fprintf(w, "if i < len(intervals) && intervals[i].Left <= addr {\nreturn intervals[i].Value.(%s), true\n}\n", g.typ)
+	fmt.Fprintf(w, "return %s, false\n}\n", goValue(g.typ, mustParse(g.typ, zeroValue(g.typ))))
+}
+
+// octetIndex returns, for each leading octet, the first interval ending
+// at or after it, and the number of intervals last
+func octetIndex(m *ipv4.IntervalMap) [257]int {
+	var index [257]int
+	i := 0
+	for octet := 0; octet < 256; octet++ {
+		for i < m.Len() && m.Intervals[i].Right < uint32(octet)<<24 {
+			i++
+		}
+		index[octet] = i
+	}
+	index[256] = m.Len()
+	return index
+}
+
+// zeroValue returns the text of the zero value of a type
+func zeroValue(typ string) string {
+	switch typ {
+	case "string":
+		return ""
+	case "bool":
+		return "false"
+	}
+	return "0"
+}
+
+// parseValue converts text to a value of the type
+func parseValue(typ, s string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return s, nil
+	case "bool":
+		return strconv.ParseBool(s)
+	case "int":
+		v, err := strconv.ParseInt(s, 0, 0)
+		return int(v), err
+	case "int64":
+		return strconv.ParseInt(s, 0, 64)
+	case "uint32":
+		v, err := strconv.ParseUint(s, 0, 32)
+		return uint32(v), err
+	case "uint64":
+		return strconv.ParseUint(s, 0, 64)
+	case "float64":
+		v, err := strconv.ParseFloat(s, 64)
+		if err == nil && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			err = fmt.Errorf("%q is not a finite number", s)
+		}
+		return v, err
+	}
+	return nil, fmt.Errorf("unsupported type %q", typ)
+}
+
+func mustParse(typ, s string) interface{} {
+	v, err := parseValue(typ, s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// goValue returns a Go expression of the value with its type, so that
+// it has the same dynamic type when stored in an interface{}
+func goValue(typ string, v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strconv.Quote(x)
+	case bool:
+		return strconv.FormatBool(x)
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return fmt.Sprintf("int64(%d)", x)
+	case uint32:
+		return fmt.Sprintf("uint32(%d)", x)
+	case uint64:
+		return fmt.Sprintf("uint64(%d)", x)
+	case float64:
+		return "float64(" + strconv.FormatFloat(x, 'g', -1, 64) + ")"
+	}
+	panic("unexpected value type " + reflect.TypeOf(v).String())
+}
+
+func isIdentifier(s string) bool {
+	if s == "" || s == "_" {
+		return false
+	}
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
+
+func upperFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
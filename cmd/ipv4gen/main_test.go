@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func generate(t *testing.T, args string, stdin string) (string, string, int) {
+	stdout := bytes.Buffer{}
+	stderr := bytes.Buffer{}
+	status := run(strings.Fields(args), strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), stderr.String(), status
+}
+
+// TestExampleUpToDate checks the generated file of the example package,
+// which also tests the generated lookup function
+func TestExampleUpToDate(t *testing.T) {
+	args := "-pkg example -var Countries -index -check -o internal/example/countries_gen.go internal/example/countries.txt"
+	if _, stderr, status := generate(t, args, ""); status != exitOK {
+		t.Errorf("expected up to date, got status %d: %s", status, stderr)
+	}
+}
+
+func TestCheckStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipv4gen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "gen.go")
+
+	if _, _, status := generate(t, "-pkg x -check -o "+out, "10.0.0.0/8 a\n"); status != exitStale {
+		t.Errorf("missing file: expected status %d, got %d", exitStale, status)
+	}
+	if _, stderr, status := generate(t, "-pkg x -o "+out, "10.0.0.0/8 a\n"); status != exitOK {
+		t.Fatalf("writing failed: %s", stderr)
+	}
+	if _, _, status := generate(t, "-pkg x -check -o "+out, "10.0.0.0/8 a\n"); status != exitOK {
+		t.Errorf("expected up to date, got status %d", status)
+	}
+	_, stderr, status := generate(t, "-pkg x -check -o "+out, "10.0.0.0/8 b\n")
+	if status != exitStale || !strings.Contains(stderr, "out of date") {
+		t.Errorf("expected stale, got status %d: %s", status, stderr)
+	}
+}
+
+func TestTypes(t *testing.T) {
+	cases := []struct {
+		args  string
+		stdin string
+		want  []string
+	}{
+		{"-pkg x -type bool", "10.0.0.0/24\n10.0.1.0/24 false\n", []string{
+			`{Left: 0x0a000000, Right: 0x0a0000ff, Value: true},`,
+			`{Left: 0x0a000100, Right: 0x0a0001ff, Value: false}, // 10.0.1.0-10.0.1.255`,
+		}},
+		{"-pkg x -type int -value 7", "10.0.0.0/24\n10.0.1.0/24 0x7\n10.0.2.0/24 ; -3\n", []string{
+			`{Left: 0x0a000000, Right: 0x0a0001ff, Value: 7},`,
+			`Value: -3}`,
+		}},
+		{"-pkg x -type uint32 -var asns", "10.0.0.0/24 13335\n", []string{
+			`var asns = &ipv4.IntervalMap{`,
+			`Value: uint32(13335)}`,
+		}},
+		{"-pkg x -type int64", "10.0.0.0/24 ; -1\n", []string{`Value: int64(-1)}`}},
+		{"-pkg x -type uint64", "10.0.0.0/24 1\n", []string{`Value: uint64(1)}`}},
+		// equal typed values are not merged into an interval Valid rejects
+		{"-pkg x -type int", "0.0.0.0/1 1\n128.0.0.0/1 0x1\n", []string{
+			`{Left: 0x00000000, Right: 0x7fffffff, Value: 1},`,
+			`{Left: 0x80000000, Right: 0xffffffff, Value: 1},`,
+		}},
+		{"-pkg x -type float64", "10.0.0.0/24 0.5\n10.0.1.0/24 2\n", []string{
+			`Value: float64(0.5)}`, `Value: float64(2)}`,
+		}},
+		{"-pkg x -type string", "10.0.0.0/24 \"quoted\" \\ value\n", []string{
+			`Value: "\"quoted\" \\ value"}`,
+		}},
+		{"-pkg x -type uint32 -var asns -index", "10.0.0.0/24 1\n", []string{
+			"\t\"sort\"\n",
+			`func lookupAsns(addr uint32) (uint32, bool) {`,
+			`return intervals[i].Value.(uint32), true`,
+			`return uint32(0), false`,
+		}},
+		{"-pkg x -csv -header -start 0 -end 1 -column 2", "start,end,cc\n1.0.0.0,1.0.0.255,AU\n16777472,16777727,CN\n", []string{
+			`Value: "AU"}, // 1.0.0.0-1.0.0.255`,
+			`Value: "CN"}, // 1.0.1.0-1.0.1.255`,
+		}},
+		{"-pkg x -csv -network 0 -value yes", "1.0.0.0/24\n", []string{`Value: "yes"}`}},
+	}
+	for _, tt := range cases {
+		out, stderr, status := generate(t, tt.args, tt.stdin)
+		if status != exitOK {
+			t.Errorf("%q: status %d: %s", tt.args, status, stderr)
+			continue
+		}
+		if !strings.HasPrefix(out, "// Code generated by ipv4gen from stdin; DO NOT EDIT.\n\npackage x\n") {
+			t.Errorf("%q: bad header:\n%s", tt.args, out)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%q: expected %q in\n%s", tt.args, want, out)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	os.Unsetenv("GOPACKAGE")
+	cases := []struct {
+		args  string
+		stdin string
+	}{
+		{"", "10.0.0.0/8\n"},
+		{"-pkg 1x", ""},
+		{"-pkg x -var a-b", ""},
+		{"-pkg x -type complex128", ""},
+		{"-pkg x -type int", "10.0.0.0/8 ten\n"},
+		{"-pkg x -type float64", "10.0.0.0/8 NaN\n"},
+		{"-pkg x", "not an address\n"},
+		{"-pkg x -csv", "1.0.0.0/24\n"},
+		{"-pkg x -csv -network 0 -column 3", "1.0.0.0/24,a\n"},
+		{"-pkg x missing.txt", ""},
+		{"-pkg x -check", ""},
+		{"-bogus", ""},
+	}
+	for _, tt := range cases {
+		_, stderr, status := generate(t, tt.args, tt.stdin)
+		if status != exitError || stderr == "" {
+			t.Errorf("%q: expected error, got status %d: %s", tt.args, status, stderr)
+		}
+	}
+
+	os.Setenv("GOPACKAGE", "fromenv")
+	defer os.Unsetenv("GOPACKAGE")
+	out, _, status := generate(t, "", "10.0.0.0/8\n")
+	if status != exitOK || !strings.Contains(out, "package fromenv\n") {
+		t.Errorf("expected package from $GOPACKAGE, got %d:\n%s", status, out)
+	}
+}
+
+func TestOctetIndex(t *testing.T) {
+	out, _, status := generate(t, "-pkg x -index", "0.0.0.0-0.0.0.0 a\n255.255.255.255 b\n")
+	if status != exitOK {
+		t.Fatal(status)
+	}
+	// interval 1 starts in the last octet, which ends the table
+	if !strings.Contains(out, "1, 1, 1, 1,\n\t2,\n}") {
+		t.Errorf("unexpected index:\n%s", out)
+	}
+}
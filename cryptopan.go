@@ -0,0 +1,85 @@
+package ipv4
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"fmt"
+)
+
+// Anonymizer does prefix-preserving anonymization of addresses with the
+// Crypto-PAn scheme: two addresses sharing a k-bit prefix still share a
+// k-bit prefix after anonymization, so subnet structure survives while
+// the addresses themselves are hidden.
+//
+// See Xu, Fan, Ammar and Moon, "Prefix-Preserving IP Address
+// Anonymization", ICNP 2002.
+type Anonymizer struct {
+	block cipher.Block
+	pad   [aes.BlockSize]byte
+}
+
+// NewAnonymizer creates an Anonymizer from a 32 byte secret.  The first
+// 16 bytes are the AES key and the last 16 seed the padding.
+func NewAnonymizer(key []byte) (*Anonymizer, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Crypto-PAn key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key[:16])
+	if err != nil {
+		return nil, err
+	}
+	a := &Anonymizer{block: block}
+	block.Encrypt(a.pad[:], key[16:])
+	return a, nil
+}
+
+// otp returns the one-time-pad bit for position pos, which depends only
+// on the first pos bits of the original address
+func (a *Anonymizer) otp(orig uint32, pos uint) uint32 {
+	pad4 := binary.BigEndian.Uint32(a.pad[:4])
+	var in, out [aes.BlockSize]byte
+	copy(in[:], a.pad[:])
+	// shifts of 32 give 0, so pos 0 is all padding
+	prefix := orig >> (32 - pos) << (32 - pos)
+	binary.BigEndian.PutUint32(in[:4], prefix|pad4<<pos>>pos)
+	a.block.Encrypt(out[:], in[:])
+	return uint32(out[0] >> 7)
+}
+
+// Anonymize returns the anonymized form of an address
+func (a *Anonymizer) Anonymize(addr uint32) uint32 {
+	var result uint32
+	for pos := uint(0); pos < 32; pos++ {
+		result |= a.otp(addr, pos) << (31 - pos)
+	}
+	return result ^ addr
+}
+
+// Deanonymize reverses Anonymize.  Only holders of the key can do this.
+func (a *Anonymizer) Deanonymize(anon uint32) uint32 {
+	var orig uint32
+	for pos := uint(0); pos < 32; pos++ {
+		bit := uint32(1) << (31 - pos)
+		orig |= (anon ^ a.otp(orig, pos)<<(31-pos)) & bit
+	}
+	return orig
+}
+
+// AnonymizeDots is Anonymize for dotted addresses
+func (a *Anonymizer) AnonymizeDots(dots string) (string, error) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return "", err
+	}
+	return ToDots(a.Anonymize(addr)), nil
+}
+
+// DeanonymizeDots is Deanonymize for dotted addresses
+func (a *Anonymizer) DeanonymizeDots(dots string) (string, error) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return "", err
+	}
+	return ToDots(a.Deanonymize(addr)), nil
+}
@@ -0,0 +1,116 @@
+package ipv4
+
+import (
+	"math/bits"
+	"testing"
+)
+
+// key and vectors from the sample trace in the Crypto-PAn reference
+// implementation
+var cryptoPAnKey = []byte{
+	21, 34, 23, 141, 51, 164, 207, 128, 19, 10, 91, 22, 73, 144, 125, 16,
+	216, 152, 143, 131, 121, 121, 101, 39, 98, 87, 76, 45, 42, 132, 34, 2,
+}
+
+var cryptoPAnVectors = []struct {
+	raw  string
+	anon string
+}{
+	{"128.11.68.132", "135.242.180.132"},
+	{"129.118.74.4", "134.136.186.123"},
+	{"130.132.252.244", "133.68.164.234"},
+	{"141.223.7.43", "141.167.8.160"},
+	{"141.233.145.108", "141.129.237.235"},
+	{"152.163.225.39", "151.140.114.167"},
+	{"156.29.3.236", "147.225.12.42"},
+	{"165.247.96.84", "162.9.99.234"},
+	{"166.107.77.190", "160.132.178.185"},
+	{"192.102.249.13", "252.138.62.131"},
+	{"192.215.32.125", "252.43.47.189"},
+	{"192.233.80.103", "252.25.108.8"},
+	{"192.41.57.43", "252.222.221.184"},
+	{"193.150.244.223", "253.169.52.216"},
+	{"195.205.63.100", "255.186.223.5"},
+	{"198.200.171.101", "249.199.68.213"},
+	{"198.26.132.101", "249.36.123.202"},
+	{"198.36.213.5", "249.7.21.132"},
+	{"198.51.77.238", "249.18.186.254"},
+	{"199.217.79.101", "248.38.184.213"},
+	{"202.49.198.20", "245.206.7.234"},
+	{"203.12.160.252", "244.248.163.4"},
+	{"204.184.162.189", "243.192.77.90"},
+	{"204.202.136.230", "243.178.4.198"},
+	{"204.29.20.4", "243.33.20.123"},
+	{"205.178.38.67", "242.108.198.51"},
+	{"205.188.147.153", "242.96.16.101"},
+	{"205.188.248.25", "242.96.88.27"},
+	{"205.245.121.43", "242.21.121.163"},
+	{"207.105.49.5", "241.118.205.138"},
+	{"207.135.65.238", "241.202.129.222"},
+	{"207.155.9.214", "241.220.250.22"},
+	{"207.188.7.45", "241.255.249.220"},
+	{"207.25.71.27", "241.33.119.156"},
+	{"207.33.151.131", "241.1.233.131"},
+	{"208.147.89.59", "227.237.98.191"},
+	{"208.234.120.210", "227.154.67.17"},
+	{"208.28.185.184", "227.39.94.90"},
+	{"208.52.56.122", "227.8.63.165"},
+	{"209.12.231.7", "226.243.167.8"},
+	{"209.238.72.3", "226.6.119.243"},
+	{"209.246.74.109", "226.22.124.76"},
+	{"209.68.60.238", "226.184.220.233"},
+}
+
+func TestAnonymizerVectors(t *testing.T) {
+	a, err := NewAnonymizer(cryptoPAnKey)
+	if err != nil {
+		t.Fatalf("NewAnonymizer failed: %s", err)
+	}
+	for _, v := range cryptoPAnVectors {
+		got, err := a.AnonymizeDots(v.raw)
+		if err != nil || got != v.anon {
+			t.Errorf("AnonymizeDots(%s) = %s, %v, want %s", v.raw, got, err, v.anon)
+		}
+		back, err := a.DeanonymizeDots(v.anon)
+		if err != nil || back != v.raw {
+			t.Errorf("DeanonymizeDots(%s) = %s, %v, want %s", v.anon, back, err, v.raw)
+		}
+	}
+}
+
+func TestAnonymizerPrefixPreserving(t *testing.T) {
+	a, _ := NewAnonymizer(cryptoPAnKey)
+	addrs := []uint32{0, 1, 0x0A000001, 0x0A000101, 0x0A010101, 0xC0A80001, 0xC0A800FF, 0xFFFFFFFF}
+	for _, x := range addrs {
+		for _, y := range addrs {
+			shared := bits.LeadingZeros32(x ^ y)
+			anon := bits.LeadingZeros32(a.Anonymize(x) ^ a.Anonymize(y))
+			if shared != anon {
+				t.Errorf("%s and %s share %d bits, anonymized share %d",
+					ToDots(x), ToDots(y), shared, anon)
+			}
+		}
+	}
+}
+
+func TestAnonymizerErrors(t *testing.T) {
+	if _, err := NewAnonymizer(make([]byte, 16)); err == nil {
+		t.Errorf("Expected error on short key")
+	}
+	a, _ := NewAnonymizer(cryptoPAnKey)
+	if _, err := a.AnonymizeDots("junk"); err == nil {
+		t.Errorf("Expected error on bad address")
+	}
+	if _, err := a.DeanonymizeDots("junk"); err == nil {
+		t.Errorf("Expected error on bad address")
+	}
+}
+
+func BenchmarkAnonymize(b *testing.B) {
+	a, _ := NewAnonymizer(cryptoPAnKey)
+	var out uint32
+	for i := 0; i < b.N; i++ {
+		out = a.Anonymize(uint32(i))
+	}
+	tempUint32 = out
+}
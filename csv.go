@@ -0,0 +1,240 @@
+package ipv4
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LineError is an error found at a given line of an input file
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// errNotIPv4 marks IPv6 rows in mixed databases, they are skipped
+var errNotIPv4 = errors.New("not an IPv4 address")
+
+// CSVLoader streams rows of an IP range database in CSV form into an
+// IntervalMap.
+//
+// The bounds of each row come either from a single column holding a
+// CIDR (Network) or from a pair of columns (Start, End) holding dotted
+// or integer addresses.  Set unused columns to -1.  Rows for IPv6
+// networks are skipped.
+type CSVLoader struct {
+	Comma      rune // field delimiter, ',' if 0
+	Comment    rune // lines starting with this are ignored if not 0
+	LazyQuotes bool // allow quotes in unquoted fields
+	SkipHeader bool // skip the first row
+
+	Network int // column with a CIDR, or -1
+	Start   int // column with the first address of the range, or -1
+	End     int // column with the last address of the range, or -1
+
+	// Value constructs the interval value from a row.  If nil the value
+	// is true.
+	Value func(row []string) (interface{}, error)
+}
+
+// GeoLite2BlocksCSV returns a loader for the MaxMind GeoLite2 "Blocks"
+// files, where the first column is the network in CIDR notation
+//
+//	network,geoname_id,registered_country_geoname_id,...
+//	1.0.0.0/24,2077456,2077456,,0,0
+func GeoLite2BlocksCSV(value func(row []string) (interface{}, error)) CSVLoader {
+	return CSVLoader{SkipHeader: true, Network: 0, Start: -1, End: -1, Value: value}
+}
+
+// IP2LocationCSV returns a loader for IP2Location files, where the first
+// two columns are integer bounds
+//
+//	"16777216","16777471","US","United States of America"
+func IP2LocationCSV(value func(row []string) (interface{}, error)) CSVLoader {
+	return CSVLoader{Network: -1, Start: 0, End: 1, Value: value}
+}
+
+// DBIPCSV returns a loader for DB-IP files, where the first two columns
+// are dotted bounds
+//
+//	1.0.0.0,1.0.0.255,AU
+func DBIPCSV(value func(row []string) (interface{}, error)) CSVLoader {
+	return CSVLoader{Network: -1, Start: 0, End: 1, Value: value}
+}
+
+// Read streams the rows, calling fn with the bounds of each.  The first
+// bad row stops reading with a *LineError.  The row slice is reused
+// between calls.
+func (l CSVLoader) Read(r io.Reader, fn func(left, right uint32, row []string) error) error {
+	lr := &csvLineReader{r: bufio.NewReader(r)}
+	cr := csv.NewReader(lr)
+	if l.Comma != 0 {
+		cr.Comma = l.Comma
+	}
+	cr.Comment = l.Comment
+	cr.LazyQuotes = l.LazyQuotes
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	for record := 1; ; record++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if perr, ok := err.(*csv.ParseError); ok {
+				return &LineError{Line: perr.Line, Err: perr.Err}
+			}
+			return err
+		}
+		if record == 1 && l.SkipHeader {
+			continue
+		}
+		line := lr.recordLine(row)
+		left, right, err := l.bounds(row)
+		if err == errNotIPv4 {
+			continue
+		}
+		if err == nil {
+			err = fn(left, right, row)
+		}
+		if err != nil {
+			return &LineError{Line: line, Err: err}
+		}
+	}
+}
+
+// csvLineReader hands csv.Reader one line per Read, so that when a record
+// has been returned its last line is the last one read.  csv.Reader only
+// reads more when its buffer holds no complete line.
+type csvLineReader struct {
+	r       *bufio.Reader
+	pending []byte
+	lines   int
+	partial bool // the last line read has no line break yet
+}
+
+func (lr *csvLineReader) Read(p []byte) (int, error) {
+	if len(lr.pending) == 0 {
+		line, err := lr.r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			err = nil
+		}
+		if len(line) == 0 {
+			return 0, err
+		}
+		if !lr.partial {
+			lr.lines++
+		}
+		lr.partial = line[len(line)-1] != '\n'
+		lr.pending = line
+	}
+	n := copy(p, lr.pending)
+	lr.pending = lr.pending[n:]
+	return n, nil
+}
+
+// recordLine returns the first line of a record just read, the last line
+// less the line breaks within its fields
+func (lr *csvLineReader) recordLine(row []string) int {
+	line := lr.lines
+	for _, field := range row {
+		line -= strings.Count(field, "\n")
+	}
+	return line
+}
+
+// Load reads all rows into the interval map
+func (l CSVLoader) Load(r io.Reader, m *IntervalMap) error {
+	return l.Read(r, func(left, right uint32, row []string) error {
+		var value interface{} = true
+		if l.Value != nil {
+			var err error
+			if value, err = l.Value(row); err != nil {
+				return err
+			}
+		}
+		return m.insert(left, right, value)
+	})
+}
+
+func (l CSVLoader) column(row []string, col int) (string, error) {
+	if col >= len(row) {
+		return "", fmt.Errorf("missing column %d, row has %d", col, len(row))
+	}
+	return strings.TrimSpace(row[col]), nil
+}
+
+func (l CSVLoader) bounds(row []string) (uint32, uint32, error) {
+	if l.Network >= 0 {
+		cidr, err := l.column(row, l.Network)
+		if err != nil {
+			return 0, 0, err
+		}
+		if strings.IndexByte(cidr, ':') != -1 {
+			return 0, 0, errNotIPv4
+		}
+		return cidrBounds(cidr)
+	}
+
+	if l.Start < 0 || l.End < 0 {
+		return 0, 0, errors.New("no columns configured for the bounds")
+	}
+	start, err := l.column(row, l.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := l.column(row, l.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	left, err := parseCSVAddr(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	right, err := parseCSVAddr(end)
+	if err != nil {
+		return 0, 0, err
+	}
+	if left > right {
+		return 0, 0, fmt.Errorf("start %s > end %s", ToDots(left), ToDots(right))
+	}
+	return left, right, nil
+}
+
+// parseCSVAddr parses a dotted or integer address.  IPv4-mapped IPv6
+// integers (as used by IP2Location IPv6 files) are converted.
+func parseCSVAddr(s string) (uint32, error) {
+	if strings.IndexByte(s, ':') != -1 {
+		return 0, errNotIPv4
+	}
+	if strings.IndexByte(s, '.') != -1 {
+		addr, err := FromDots(s)
+		if err != nil {
+			return 0, fmt.Errorf("Unable to parse %q", s)
+		}
+		return addr, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		if nerr, ok := err.(*strconv.NumError); ok && nerr.Err == strconv.ErrRange {
+			return 0, errNotIPv4
+		}
+		return 0, fmt.Errorf("Unable to parse %q", s)
+	}
+	switch {
+	case n <= 0xFFFFFFFF:
+		return uint32(n), nil
+	case n>>32 == 0xFFFF:
+		return uint32(n), nil
+	}
+	return 0, errNotIPv4
+}
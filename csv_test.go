@@ -0,0 +1,120 @@
+package ipv4
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func secondColumn(row []string) (interface{}, error) {
+	if len(row) < 2 {
+		return nil, errors.New("missing value")
+	}
+	return row[1], nil
+}
+
+func TestGeoLite2BlocksCSV(t *testing.T) {
+	in := `network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider
+1.0.0.0/24,2077456,2077456,,0,0
+1.0.1.0/24,1814991,1814991,,0,0
+1.0.2.0/23,1814991,1814991,,0,0
+2001:200::/32,1861060,1861060,,0,0
+6.0.0.0/7,6252001,6252001,,0,0
+`
+	m := NewIntervalMap(10)
+	if err := GeoLite2BlocksCSV(secondColumn).Load(strings.NewReader(in), m); err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	if err := m.Valid(); err != nil {
+		t.Fatalf("Invalid map: %s", err)
+	}
+	if m.Len() != 3 {
+		t.Errorf("Expected 3 intervals, got %d:\n%s", m.Len(), m)
+	}
+	tests := map[string]interface{}{
+		"1.0.0.1":         "2077456",
+		"1.0.3.255":       "1814991",
+		"1.0.4.0":         nil,
+		"7.255.255.255":   "6252001",
+		"255.255.255.255": nil,
+	}
+	for dots, want := range tests {
+		if got := m.Contains(dots); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", dots, got, want)
+		}
+	}
+}
+
+func TestIP2LocationCSV(t *testing.T) {
+	in := `"16777216","16777471","US","United States of America"
+"16777472","16778239","CN","China"
+"0","281470681743359","-","-"
+"281470698521600","281470698521855","AU","Australia"
+`
+	m := NewIntervalMap(10)
+	if err := IP2LocationCSV(func(row []string) (interface{}, error) {
+		return row[2], nil
+	}).Load(strings.NewReader(in), m); err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	tests := map[string]interface{}{
+		"1.0.0.0":   "US",
+		"1.0.3.255": "CN",
+		"1.0.4.0":   "AU",
+		"0.0.0.1":   nil,
+	}
+	for dots, want := range tests {
+		if got := m.Contains(dots); got != want {
+			t.Errorf("Contains(%q) = %v, want %v", dots, got, want)
+		}
+	}
+}
+
+func TestDBIPCSV(t *testing.T) {
+	in := `1.0.0.0,1.0.0.255,AU
+1.0.1.0,1.0.3.255,CN
+2001:200::,2001:200:ffff:ffff:ffff:ffff:ffff:ffff,JP
+`
+	m := NewIntervalMap(10)
+	if err := DBIPCSV(func(row []string) (interface{}, error) {
+		return row[2], nil
+	}).Load(strings.NewReader(in), m); err != nil {
+		t.Fatalf("Load failed: %s", err)
+	}
+	if m.Len() != 2 || m.Contains("1.0.2.2") != "CN" {
+		t.Errorf("Unexpected map:\n%s", m)
+	}
+}
+
+func TestCSVLoaderErrors(t *testing.T) {
+	tests := []struct {
+		loader CSVLoader
+		in     string
+		line   int
+	}{
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255\n1.0.1.0,busted\n", 2},
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255\n1.0.1.0\n", 2},
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255\n1.0.0.0,1.0.0.255\n1.0.1.9,1.0.1.0\n", 3},
+		{IP2LocationCSV(nil), "\"1\",\"2\"\n\"-5\",\"10\"\n", 2},
+		{GeoLite2BlocksCSV(nil), "network\n1.0.0.0/33\n", 2},
+		{GeoLite2BlocksCSV(secondColumn), "network\n1.0.0.0/24,x\n1.0.1.0/24\n", 3},
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255\n\"1.0.1.0,1.0.1.255\n", 2},
+		{CSVLoader{Network: -1, Start: -1, End: -1}, "1.0.0.0,1.0.0.255\n", 1},
+		{CSVLoader{Comment: '#', Network: -1, Start: 0, End: 1}, "# a\n# b\n1.0.0.0,1.0.0.255\n\n1.0.1.0,bad\n", 5},
+		{CSVLoader{Network: -1, Start: 0, End: 1}, "\n\n\r\n1.0.1.0,bad\n", 4},
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255,\"two\nlines\"\n1.0.1.0,1.0.1.255,\"x\r\ny\r\nz\"\n1.0.2.0,bad\n", 6},
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255,\"two\nlines\"\n1.0.1.0,bad,\"x\ny\"\n", 3},
+		{DBIPCSV(nil), "1.0.0.0,1.0.0.255," + strings.Repeat("x", 5000) + "\n1.0.1.0,bad", 2},
+	}
+	for pos, tt := range tests {
+		err := tt.loader.Load(strings.NewReader(tt.in), NewIntervalMap(10))
+		lerr, ok := err.(*LineError)
+		if !ok {
+			t.Errorf("test %d: expected *LineError, got %v", pos, err)
+			continue
+		}
+		if lerr.Line != tt.line {
+			t.Errorf("test %d: error on line %d, want %d: %s", pos, lerr.Line, tt.line, lerr)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package ipv4
+
+import (
+	"bytes"
+	"io"
+)
+
+// Extracted is an address or CIDR found by an Extractor
+type Extracted struct {
+	Offset int64  // byte offset of the match in the stream
+	Text   string // the match as written, e.g. "1[.]2[.]3[.]4"
+	Left   uint32
+	Right  uint32
+	Bits   byte // prefix length, 32 for a single address
+}
+
+// extractLookahead is more than the longest possible match, which is a
+// defanged CIDR like "255[dot]255[dot]255[dot]255/32"
+const extractLookahead = 64
+
+// extractLookbehind is kept before the current position, enough for the
+// longest defanged dot
+const extractLookbehind = 8
+
+// defangedDots are the separators recognized when Defanged is set
+var defangedDots = [][]byte{
+	[]byte("[.]"), []byte("(.)"), []byte("{.}"), []byte("[dot]"), []byte("(dot)"),
+}
+
+// Extractor scans text from a reader for IPv4 addresses and CIDRs, such
+// as access logs, email headers or JSON.
+//
+// Matches must stand alone: "1.2.3.4.5", "v1.2.3.4" and "1.2.3.4abc"
+// are not matched, while a trailing period as in "from 1.2.3.4." is
+// allowed.
+//
+//	ex := ipv4.NewExtractor(r)
+//	for ex.Next() {
+//		m := ex.Match()
+//		...
+//	}
+//	if err := ex.Err(); err != nil {
+//		...
+//	}
+type Extractor struct {
+	// Defanged also matches addresses written with "[.]", "(.)", "{.}",
+	// "[dot]" or "(dot)" in place of dots, as in threat reports
+	Defanged bool
+
+	r     io.Reader
+	buf   []byte
+	pos   int
+	base  int64
+	eof   bool
+	err   error
+	match Extracted
+	dots  [len("255.255.255.255")]byte
+}
+
+// NewExtractor creates an Extractor reading from r
+func NewExtractor(r io.Reader) *Extractor {
+	return &Extractor{
+		r:   r,
+		buf: make([]byte, 0, 32*1024),
+	}
+}
+
+// Next advances to the next match, returning false at the end of the
+// input or on a read error
+func (e *Extractor) Next() bool {
+	for {
+		if !e.eof && len(e.buf)-e.pos < extractLookahead {
+			e.fill()
+			continue
+		}
+		if e.pos >= len(e.buf) {
+			return false
+		}
+		i := e.pos
+		e.pos++
+		if !isDigit(e.buf[i]) || (i > 0 && isWordByte(e.buf[i-1])) || e.afterSeparator(i) {
+			continue
+		}
+		if end, ok := e.matchAt(i); ok {
+			e.match.Offset = e.base + int64(i)
+			e.match.Text = string(e.buf[i:end])
+			e.pos = end
+			return true
+		}
+	}
+}
+
+// Match returns the match found by the last call to Next
+func (e *Extractor) Match() Extracted {
+	return e.match
+}
+
+// Err returns the first read error, if any
+func (e *Extractor) Err() error {
+	return e.err
+}
+
+// AddToSet reads every remaining single address into a Set.  CIDRs are
+// skipped rather than expanded.
+func (e *Extractor) AddToSet(s *Set) error {
+	in := *s
+	for e.Next() {
+		if e.match.Bits == 32 {
+			in = append(in, e.match.Left)
+		}
+	}
+	*s = in
+	s.sort()
+	return e.err
+}
+
+// AddToIntervalMap reads every remaining address and CIDR into an
+// IntervalMap with the given value
+func (e *Extractor) AddToIntervalMap(m *IntervalMap, value interface{}) error {
+	for e.Next() {
+		if err := m.insert(e.match.Left, e.match.Right, value); err != nil {
+			return err
+		}
+	}
+	return e.err
+}
+
+// fill reads more input, keeping a few bytes before pos for the boundary
+// checks
+func (e *Extractor) fill() {
+	if keep := e.pos - extractLookbehind; keep > 0 {
+		n := copy(e.buf, e.buf[keep:])
+		e.buf = e.buf[:n]
+		e.base += int64(keep)
+		e.pos -= keep
+	}
+	if cap(e.buf)-len(e.buf) < extractLookahead {
+		grown := make([]byte, len(e.buf), 2*cap(e.buf)+extractLookahead)
+		copy(grown, e.buf)
+		e.buf = grown
+	}
+	n, err := e.r.Read(e.buf[len(e.buf):cap(e.buf)])
+	e.buf = e.buf[:len(e.buf)+n]
+	if err != nil {
+		e.eof = true
+		if err != io.EOF {
+			e.err = err
+		}
+	}
+}
+
+// separator returns the length of a dot (or defanged dot) at j, or 0
+func (e *Extractor) separator(j int) int {
+	if j >= len(e.buf) {
+		return 0
+	}
+	if e.buf[j] == '.' {
+		return 1
+	}
+	if e.Defanged {
+		for _, d := range defangedDots {
+			if bytes.HasPrefix(e.buf[j:], d) {
+				return len(d)
+			}
+		}
+	}
+	return 0
+}
+
+// afterSeparator returns true if a defanged dot ends just before i, as
+// in the "5" of "4[.]5"
+func (e *Extractor) afterSeparator(i int) bool {
+	if !e.Defanged {
+		return false
+	}
+	for _, d := range defangedDots {
+		if i >= len(d) && bytes.Equal(e.buf[i-len(d):i], d) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAt tries to match an address starting at i, returning the end
+func (e *Extractor) matchAt(i int) (int, bool) {
+	buf := e.buf
+	n := 0
+	j := i
+	for octet := 0; octet < 4; octet++ {
+		if octet > 0 {
+			sep := e.separator(j)
+			if sep == 0 {
+				return 0, false
+			}
+			j += sep
+		}
+		start := j
+		for j < len(buf) && isDigit(buf[j]) && j-start < 4 {
+			j++
+		}
+		if j == start || j-start > 3 {
+			return 0, false
+		}
+		n += copy(e.dots[n:], buf[start:j])
+		if octet < 3 {
+			e.dots[n] = '.'
+			n++
+		}
+	}
+	addr, err := FromDotsBytes(e.dots[:n])
+	if err != nil {
+		return 0, false
+	}
+
+	// "1.2.3.4.5" and "1.2.3.4x" are not addresses
+	if j < len(buf) && (isWordByte(buf[j]) && buf[j] != '.') {
+		return 0, false
+	}
+	if sep := e.separator(j); sep != 0 && j+sep < len(buf) && isDigit(buf[j+sep]) {
+		return 0, false
+	}
+
+	e.match.Left, e.match.Right, e.match.Bits = addr, addr, 32
+
+	// optional "/bits"
+	if j+1 < len(buf) && buf[j] == '/' && isDigit(buf[j+1]) {
+		k := j + 1
+		bits := 0
+		for k < len(buf) && isDigit(buf[k]) && k-j <= 2 {
+			bits = bits*10 + int(buf[k]-'0')
+			k++
+		}
+		endsOK := k >= len(buf) || !isWordByte(buf[k]) ||
+			(buf[k] == '.' && (k+1 >= len(buf) || !isDigit(buf[k+1])))
+		if bits <= 32 && endsOK {
+			hostmask := uint32(uint64(1)<<uint(32-bits) - 1)
+			e.match.Left = addr &^ hostmask
+			e.match.Right = addr | hostmask
+			e.match.Bits = byte(bits)
+			return k, true
+		}
+	}
+	return j, true
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// isWordByte returns true for bytes that can not border an address
+func isWordByte(b byte) bool {
+	return isDigit(b) || b == '.' || b == '_' ||
+		(b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z')
+}
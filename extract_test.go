@@ -0,0 +1,133 @@
+package ipv4
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func extractAll(t *testing.T, ex *Extractor) []Extracted {
+	var out []Extracted
+	for ex.Next() {
+		out = append(out, ex.Match())
+	}
+	if err := ex.Err(); err != nil {
+		t.Fatalf("Extractor error: %s", err)
+	}
+	return out
+}
+
+func TestExtractor(t *testing.T) {
+	text := `Received: from mail.example.com (mail.example.com [203.0.113.5])
+{"client":"198.51.100.7","ranges":["10.0.0.0/8","192.168.1.0/24."]}
+version v1.2.3.4 and 1.2.3.4.5 and 1.2.3.4abc and 999.1.1.1 and 1.2.3
+at 8.8.8.8. http://1.2.3.4/123 x_5.5.5.5 1.1.1.1/33 (9.9.9.9) 10.1.2.3/8
+1[.]2[.]3[.]4`
+	want := []struct {
+		text   string
+		offset int64
+		left   string
+		right  string
+		bits   byte
+	}{
+		{"203.0.113.5", 51, "203.0.113.5", "203.0.113.5", 32},
+		{"198.51.100.7", 76, "198.51.100.7", "198.51.100.7", 32},
+		{"10.0.0.0/8", 101, "10.0.0.0", "10.255.255.255", 8},
+		{"192.168.1.0/24", 114, "192.168.1.0", "192.168.1.255", 24},
+		{"8.8.8.8", 206, "8.8.8.8", "8.8.8.8", 32},
+		{"1.2.3.4", 222, "1.2.3.4", "1.2.3.4", 32},
+		{"1.1.1.1", 244, "1.1.1.1", "1.1.1.1", 32},
+		{"9.9.9.9", 256, "9.9.9.9", "9.9.9.9", 32},
+		{"10.1.2.3/8", 265, "10.0.0.0", "10.255.255.255", 8},
+	}
+
+	// one byte reads exercise the buffer refills
+	got := extractAll(t, NewExtractor(iotest.OneByteReader(strings.NewReader(text))))
+	if len(got) != len(want) {
+		t.Fatalf("Got %d matches, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Text != w.text || g.Offset != w.offset || ToDots(g.Left) != w.left ||
+			ToDots(g.Right) != w.right || g.Bits != w.bits {
+			t.Errorf("match %d = %+v, want %+v", i, g, w)
+		}
+		if text[g.Offset:g.Offset+int64(len(g.Text))] != g.Text {
+			t.Errorf("match %d offset %d does not point at %q", i, g.Offset, g.Text)
+		}
+	}
+
+	ex := NewExtractor(strings.NewReader(text))
+	ex.Defanged = true
+	got = extractAll(t, ex)
+	if last := got[len(got)-1]; last.Text != "1[.]2[.]3[.]4" || ToDots(last.Left) != "1.2.3.4" {
+		t.Errorf("Defanged match = %+v", last)
+	}
+}
+
+func TestExtractorDefanged(t *testing.T) {
+	ex := NewExtractor(strings.NewReader("ioc 10(.)0(.)0(.)1 and 10[dot]0[dot]0[dot]2 and 10{.}0{.}0{.}3/24 and 10[.]0[.]0[.]4[.]5"))
+	ex.Defanged = true
+	got := extractAll(t, ex)
+	want := []string{"10(.)0(.)0(.)1", "10[dot]0[dot]0[dot]2", "10{.}0{.}0{.}3/24"}
+	if len(got) != len(want) {
+		t.Fatalf("Got %+v", got)
+	}
+	for i, w := range want {
+		if got[i].Text != w {
+			t.Errorf("match %d = %q, want %q", i, got[i].Text, w)
+		}
+	}
+}
+
+func TestExtractorLongInput(t *testing.T) {
+	// addresses straddling many buffer boundaries
+	var sb strings.Builder
+	for i := 0; i < 20000; i++ {
+		sb.WriteString("client=10.0.0.1 ")
+	}
+	ex := NewExtractor(strings.NewReader(sb.String()))
+	s := Set{}
+	if err := ex.AddToSet(&s); err != nil {
+		t.Fatalf("AddToSet failed: %s", err)
+	}
+	if len(s) != 1 || !s.Contains("10.0.0.1") {
+		t.Errorf("Unexpected set %v", s.ToDots())
+	}
+}
+
+func TestExtractorIntervalMap(t *testing.T) {
+	m := NewIntervalMap(10)
+	ex := NewExtractor(strings.NewReader("10.0.0.0/24 10.0.1.0/24 1.2.3.4"))
+	if err := ex.AddToIntervalMap(m, "seen"); err != nil {
+		t.Fatalf("AddToIntervalMap failed: %s", err)
+	}
+	if m.Len() != 2 || m.Contains("10.0.1.9") != "seen" || m.Contains("1.2.3.4") != "seen" {
+		t.Errorf("Unexpected map:\n%s", m)
+	}
+}
+
+func TestExtractorReadError(t *testing.T) {
+	boom := errors.New("boom")
+	ex := NewExtractor(iotest.DataErrReader(&errReader{data: "1.2.3.4 ", err: boom}))
+	for ex.Next() {
+	}
+	if ex.Err() != boom {
+		t.Errorf("Err() = %v, want %v", ex.Err(), boom)
+	}
+}
+
+type errReader struct {
+	data string
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
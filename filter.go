@@ -0,0 +1,623 @@
+package ipv4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrFilterFull is returned when a CuckooFilter has no room for an item
+var ErrFilterFull = errors.New("filter is full")
+
+var errBadFilter = errors.New("invalid filter encoding")
+
+// maxFilterExpansion limits how many prefixes one CIDR may expand to
+const maxFilterExpansion = 1 << 16
+
+// filterLengths are the prefix lengths a filter stores, sorted and
+// always including 32 so single addresses can be held exactly
+type filterLengths []byte
+
+func newFilterLengths(lengths []byte) (filterLengths, error) {
+	out := filterLengths{32}
+	for _, l := range lengths {
+		if l > 32 {
+			return nil, fmt.Errorf("prefix length %d over 32", l)
+		}
+		out = append(out, l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	j := 0
+	for i := 1; i < len(out); i++ {
+		if out[i] != out[j] {
+			j++
+			out[j] = out[i]
+		}
+	}
+	return out[:j+1], nil
+}
+
+// expand calls fn with the stored prefixes that exactly cover a CIDR:
+// the CIDR itself if its length is stored, otherwise its subnets at the
+// next stored length
+func (fl filterLengths) expand(prefix uint32, bits byte, fn func(key uint64) error) error {
+	i := sort.Search(len(fl), func(i int) bool { return fl[i] >= bits })
+	l := fl[i]
+	if l-bits > 16 {
+		return fmt.Errorf("%s/%d expands to more than %d /%d prefixes",
+			ToDots(prefix), bits, maxFilterExpansion, l)
+	}
+	prefix = Mask(prefix, bits)
+	step := uint64(1) << (32 - l)
+	for n := uint64(0); n < uint64(1)<<(l-bits); n++ {
+		if err := fn(filterKey(uint32(uint64(prefix)+n*step), l)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// count returns the number of keys an interval map expands to
+func (fl filterLengths) count(m *IntervalMap) (int, error) {
+	n := 0
+	var err error
+	for _, iv := range m.Intervals {
+		if iv.Value == nil {
+			continue
+		}
+		Interval2CIDRs(iv.Left, iv.Right, func(left uint32, bits byte) {
+			if err == nil {
+				err = fl.expand(left, bits, func(uint64) error { n++; return nil })
+			}
+		})
+	}
+	return n, err
+}
+
+// each calls fn for every key of the non-nil intervals of a map
+func (fl filterLengths) each(m *IntervalMap, fn func(key uint64) error) error {
+	var err error
+	for _, iv := range m.Intervals {
+		if iv.Value == nil {
+			continue
+		}
+		Interval2CIDRs(iv.Left, iv.Right, func(left uint32, bits byte) {
+			if err == nil {
+				err = fl.expand(left, bits, fn)
+			}
+		})
+	}
+	return err
+}
+
+// probe calls fn with the key of every stored prefix of addr, stopping
+// when fn returns true
+func (fl filterLengths) probe(addr uint32, fn func(key uint64) bool) bool {
+	for _, l := range fl {
+		if fn(filterKey(Mask(addr, l), l)) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterKey(prefix uint32, bits byte) uint64 {
+	return mix64(uint64(prefix)<<8 | uint64(bits))
+}
+
+// mix64 is the splitmix64 finalizer
+func mix64(z uint64) uint64 {
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// parseFilterCIDR parses an address or CIDR
+func parseFilterCIDR(cidr string) (uint32, byte, error) {
+	if addr, err := FromDots(cidr); err == nil {
+		return addr, 32, nil
+	}
+	left, right, err := cidrBounds(cidr)
+	if err != nil {
+		return 0, 0, err
+	}
+	bits := byte(32)
+	for size := right - left; size != 0; size >>= 1 {
+		bits--
+	}
+	return left, bits, nil
+}
+
+// BloomFilter is a probabilistic set of addresses and CIDRs.  Contains
+// never misses an address that was added but may wrongly report one that
+// was not, at about the rate the filter was created with.
+//
+// CIDRs are stored as prefixes of the filter's lengths: a /20 in a
+// filter of lengths 16 and 24 is stored as sixteen /24s.  Every length is
+// probed on lookup, so fewer lengths make lookups faster.
+type BloomFilter struct {
+	lengths filterLengths
+	k       uint
+	m       uint64
+	words   []uint64
+}
+
+// NewBloomFilter creates a BloomFilter sized for n prefixes at a false
+// positive rate of fpRate per lookup.  Besides 32, which is always
+// included, lengths are the prefix lengths CIDRs are stored at.
+func NewBloomFilter(n int, fpRate float64, lengths ...byte) (*BloomFilter, error) {
+	fl, err := newFilterLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("false positive rate %g not in (0, 1)", fpRate)
+	}
+	if n < 1 {
+		n = 1
+	}
+	// each lookup probes every length
+	p := fpRate / float64(len(fl))
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) &^ 63
+	k := uint(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		lengths: fl,
+		k:       k,
+		m:       m,
+		words:   make([]uint64, m/64),
+	}, nil
+}
+
+// BloomFilterFromSet creates a BloomFilter holding every address of a Set
+func BloomFilterFromSet(s Set, fpRate float64) (*BloomFilter, error) {
+	f, err := NewBloomFilter(len(s), fpRate)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range s {
+		f.Add(addr)
+	}
+	return f, nil
+}
+
+// BloomFilterFromIntervalMap creates a BloomFilter holding every interval
+// of a map with a non-nil value
+func BloomFilterFromIntervalMap(m *IntervalMap, fpRate float64, lengths ...byte) (*BloomFilter, error) {
+	fl, err := newFilterLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+	n, err := fl.count(m)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewBloomFilter(n, fpRate, lengths...)
+	if err != nil {
+		return nil, err
+	}
+	return f, fl.each(m, func(key uint64) error {
+		f.insert(key)
+		return nil
+	})
+}
+
+// Add adds an address
+func (f *BloomFilter) Add(addr uint32) {
+	f.insert(filterKey(addr, 32))
+}
+
+// AddCIDR adds an address or CIDR
+func (f *BloomFilter) AddCIDR(cidr string) error {
+	prefix, bits, err := parseFilterCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	return f.lengths.expand(prefix, bits, func(key uint64) error {
+		f.insert(key)
+		return nil
+	})
+}
+
+// Contains reports whether an address is probably in the filter
+func (f *BloomFilter) Contains(addr uint32) bool {
+	return f.lengths.probe(addr, f.lookup)
+}
+
+// ContainsDots is Contains for dotted addresses
+func (f *BloomFilter) ContainsDots(dots string) bool {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return false
+	}
+	return f.Contains(addr)
+}
+
+// the k bit positions use double hashing, h1 + i*h2
+func (f *BloomFilter) insert(key uint64) {
+	h1, h2 := key, mix64(key)|1
+	for i := uint(0); i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.words[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *BloomFilter) lookup(key uint64) bool {
+	h1, h2 := key, mix64(key)|1
+	for i := uint(0); i < f.k; i++ {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.words[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// MarshalBinary encodes the filter
+func (f *BloomFilter) MarshalBinary() ([]byte, error) {
+	out := []byte{'B', 1, byte(f.k), byte(len(f.lengths))}
+	out = append(out, f.lengths...)
+	out = appendUint64(out, f.m)
+	for _, w := range f.words {
+		out = appendUint64(out, w)
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a filter written by MarshalBinary
+func (f *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 || data[0] != 'B' || data[1] != 1 || data[2] == 0 {
+		return errBadFilter
+	}
+	k := uint(data[2])
+	fl, data, err := readFilterLengths(data[3:])
+	if err != nil || len(data) < 8 {
+		return errBadFilter
+	}
+	m := binary.BigEndian.Uint64(data)
+	data = data[8:]
+	if m == 0 || m%64 != 0 || uint64(len(data)) != m/8 {
+		return errBadFilter
+	}
+	words := make([]uint64, m/64)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint64(data[8*i:])
+	}
+	*f = BloomFilter{lengths: fl, k: k, m: m, words: words}
+	return nil
+}
+
+// cuckooSlots is the number of fingerprints per bucket
+const cuckooSlots = 4
+
+// cuckooMaxKicks bounds the relocations tried before a filter is full
+const cuckooMaxKicks = 500
+
+// CuckooFilter is a probabilistic set like BloomFilter that also
+// supports deletion.  Only delete what was added: deleting anything else
+// may remove a different item with the same fingerprint.
+//
+// Fingerprints are at most 16 bits, which limits the false positive
+// rate to about 0.0001 per stored length.
+type CuckooFilter struct {
+	lengths filterLengths
+	fpBits  uint
+	mask    uint64 // number of buckets - 1
+	slots   []uint16
+	count   int
+	rand    uint64
+
+	// victim holds the item evicted by a failed insert so nothing is lost
+	victim      bool
+	victimIndex uint64
+	victimFP    uint16
+}
+
+// NewCuckooFilter creates a CuckooFilter sized for n prefixes at a false
+// positive rate of fpRate per lookup.  Lengths are as in NewBloomFilter.
+func NewCuckooFilter(n int, fpRate float64, lengths ...byte) (*CuckooFilter, error) {
+	fl, err := newFilterLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("false positive rate %g not in (0, 1)", fpRate)
+	}
+	// a lookup checks two buckets for every length
+	p := fpRate / float64(len(fl))
+	fpBits := uint(math.Ceil(math.Log2(2 * cuckooSlots / p)))
+	if fpBits < 4 {
+		fpBits = 4
+	}
+	if fpBits > 16 {
+		fpBits = 16
+	}
+	// up to 95% full
+	buckets := uint64(1)
+	for float64(buckets*cuckooSlots)*0.95 < float64(n) {
+		buckets <<= 1
+	}
+	return &CuckooFilter{
+		lengths: fl,
+		fpBits:  fpBits,
+		mask:    buckets - 1,
+		slots:   make([]uint16, buckets*cuckooSlots),
+		rand:    1,
+	}, nil
+}
+
+// CuckooFilterFromSet creates a CuckooFilter holding every address of a
+// Set
+func CuckooFilterFromSet(s Set, fpRate float64) (*CuckooFilter, error) {
+	f, err := NewCuckooFilter(len(s), fpRate)
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range s {
+		if err := f.Add(addr); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// CuckooFilterFromIntervalMap creates a CuckooFilter holding every
+// interval of a map with a non-nil value
+func CuckooFilterFromIntervalMap(m *IntervalMap, fpRate float64, lengths ...byte) (*CuckooFilter, error) {
+	fl, err := newFilterLengths(lengths)
+	if err != nil {
+		return nil, err
+	}
+	n, err := fl.count(m)
+	if err != nil {
+		return nil, err
+	}
+	f, err := NewCuckooFilter(n, fpRate, lengths...)
+	if err != nil {
+		return nil, err
+	}
+	return f, fl.each(m, f.insert)
+}
+
+// Len returns the number of prefixes stored
+func (f *CuckooFilter) Len() int {
+	return f.count
+}
+
+// Add adds an address.  It returns ErrFilterFull if there is no room.
+func (f *CuckooFilter) Add(addr uint32) error {
+	return f.insert(filterKey(addr, 32))
+}
+
+// AddCIDR adds an address or CIDR
+func (f *CuckooFilter) AddCIDR(cidr string) error {
+	prefix, bits, err := parseFilterCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	return f.lengths.expand(prefix, bits, f.insert)
+}
+
+// Delete removes an address, returning false if it was not found
+func (f *CuckooFilter) Delete(addr uint32) bool {
+	return f.delete(filterKey(addr, 32))
+}
+
+// DeleteCIDR removes an address or CIDR added with AddCIDR
+func (f *CuckooFilter) DeleteCIDR(cidr string) error {
+	prefix, bits, err := parseFilterCIDR(cidr)
+	if err != nil {
+		return err
+	}
+	return f.lengths.expand(prefix, bits, func(key uint64) error {
+		if !f.delete(key) {
+			return fmt.Errorf("%s not in filter", cidr)
+		}
+		return nil
+	})
+}
+
+// Contains reports whether an address is probably in the filter
+func (f *CuckooFilter) Contains(addr uint32) bool {
+	return f.lengths.probe(addr, f.lookup)
+}
+
+// ContainsDots is Contains for dotted addresses
+func (f *CuckooFilter) ContainsDots(dots string) bool {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return false
+	}
+	return f.Contains(addr)
+}
+
+// fingerprint and first bucket of a key, the fingerprint is never 0
+// which marks an empty slot
+func (f *CuckooFilter) locate(key uint64) (uint16, uint64) {
+	fp := uint16(key>>(64-f.fpBits)) & uint16(1<<f.fpBits-1)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, key & f.mask
+}
+
+// alt is the other bucket of a fingerprint, alt(alt(i)) == i
+func (f *CuckooFilter) alt(i uint64, fp uint16) uint64 {
+	return (i ^ mix64(uint64(fp))) & f.mask
+}
+
+func (f *CuckooFilter) bucket(i uint64) []uint16 {
+	return f.slots[i*cuckooSlots : (i+1)*cuckooSlots]
+}
+
+func (f *CuckooFilter) insert(key uint64) error {
+	if f.victim {
+		return ErrFilterFull
+	}
+	fp, i := f.locate(key)
+	f.insertFP(i, fp)
+	return nil
+}
+
+// insertFP places a fingerprint in bucket i or its alternate, moving
+// others aside as needed.  If that fails the last one moved becomes the
+// victim.
+func (f *CuckooFilter) insertFP(i uint64, fp uint16) {
+	f.count++
+	if f.put(i, fp) || f.put(f.alt(i, fp), fp) {
+		return
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		// xorshift picks the slot to evict
+		f.rand ^= f.rand << 13
+		f.rand ^= f.rand >> 7
+		f.rand ^= f.rand << 17
+		slot := &f.bucket(i)[f.rand%cuckooSlots]
+		fp, *slot = *slot, fp
+		i = f.alt(i, fp)
+		if f.put(i, fp) {
+			return
+		}
+	}
+	f.victim, f.victimIndex, f.victimFP = true, i, fp
+}
+
+func (f *CuckooFilter) put(i uint64, fp uint16) bool {
+	b := f.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (f *CuckooFilter) lookup(key uint64) bool {
+	fp, i := f.locate(key)
+	i2 := f.alt(i, fp)
+	if f.victim && f.victimFP == fp && (f.victimIndex == i || f.victimIndex == i2) {
+		return true
+	}
+	for _, b := range [2]uint64{i, i2} {
+		for _, s := range f.bucket(b) {
+			if s == fp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *CuckooFilter) delete(key uint64) bool {
+	fp, i := f.locate(key)
+	i2 := f.alt(i, fp)
+	if f.victim && f.victimFP == fp && (f.victimIndex == i || f.victimIndex == i2) {
+		f.victim = false
+		f.count--
+		return true
+	}
+	for _, b := range [2]uint64{i, i2} {
+		slots := f.bucket(b)
+		for j, s := range slots {
+			if s == fp {
+				slots[j] = 0
+				f.count--
+				// there is room again for the victim
+				if f.victim {
+					f.victim = false
+					f.count--
+					f.insertFP(f.victimIndex, f.victimFP)
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MarshalBinary encodes the filter
+func (f *CuckooFilter) MarshalBinary() ([]byte, error) {
+	out := []byte{'C', 1, byte(f.fpBits), byte(len(f.lengths))}
+	out = append(out, f.lengths...)
+	out = appendUint64(out, f.mask+1)
+	out = appendUint64(out, uint64(f.count))
+	out = appendUint64(out, f.rand)
+	if f.victim {
+		out = append(out, 1)
+	} else {
+		out = append(out, 0)
+	}
+	out = appendUint64(out, f.victimIndex)
+	out = append(out, byte(f.victimFP>>8), byte(f.victimFP))
+	for _, s := range f.slots {
+		out = append(out, byte(s>>8), byte(s))
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a filter written by MarshalBinary
+func (f *CuckooFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 4 || data[0] != 'C' || data[1] != 1 || data[2] < 4 || data[2] > 16 {
+		return errBadFilter
+	}
+	fpBits := uint(data[2])
+	fl, data, err := readFilterLengths(data[3:])
+	if err != nil || len(data) < 35 {
+		return errBadFilter
+	}
+	buckets := binary.BigEndian.Uint64(data)
+	count := binary.BigEndian.Uint64(data[8:])
+	out := CuckooFilter{
+		lengths:     fl,
+		fpBits:      fpBits,
+		mask:        buckets - 1,
+		count:       int(count),
+		rand:        binary.BigEndian.Uint64(data[16:]),
+		victim:      data[24] == 1,
+		victimIndex: binary.BigEndian.Uint64(data[25:]),
+		victimFP:    binary.BigEndian.Uint16(data[33:]),
+	}
+	victim := data[24]
+	data = data[35:]
+	// buckets is checked against the data before multiplying so a huge
+	// count can't wrap around
+	if buckets == 0 || buckets&(buckets-1) != 0 || buckets > uint64(len(data))/(cuckooSlots*2) ||
+		uint64(len(data)) != buckets*cuckooSlots*2 || count > buckets*cuckooSlots+1 || out.rand == 0 {
+		return errBadFilter
+	}
+	if victim > 1 || out.victimIndex > out.mask || uint32(out.victimFP) >= 1<<fpBits || (out.victim && out.victimFP == 0) {
+		return errBadFilter
+	}
+	out.slots = make([]uint16, buckets*cuckooSlots)
+	for i := range out.slots {
+		out.slots[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	*f = out
+	return nil
+}
+
+func appendUint64(out []byte, v uint64) []byte {
+	var tmp [8]byte
+	binary.BigEndian.PutUint64(tmp[:], v)
+	return append(out, tmp[:]...)
+}
+
+// readFilterLengths reads a count and that many prefix lengths
+func readFilterLengths(data []byte) (filterLengths, []byte, error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		return nil, nil, errBadFilter
+	}
+	n := int(data[0])
+	fl, err := newFilterLengths(data[1 : 1+n])
+	if err != nil || len(fl) != n {
+		return nil, nil, errBadFilter
+	}
+	return fl, data[1+n:], nil
+}
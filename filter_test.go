@@ -0,0 +1,263 @@
+package ipv4
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+// membership is the API shared by both filters
+type membership interface {
+	AddCIDR(string) error
+	Contains(uint32) bool
+	ContainsDots(string) bool
+	MarshalBinary() ([]byte, error)
+}
+
+// fpRate measures the false positive rate over random addresses outside
+// 10.0.0.0/8
+func fpRate(f membership, r *rand.Rand) float64 {
+	hits := 0
+	const trials = 100000
+	for i := 0; i < trials; i++ {
+		addr := r.Uint32()
+		if addr>>24 == 10 {
+			addr ^= 0x80000000
+		}
+		if f.Contains(addr) {
+			hits++
+		}
+	}
+	return float64(hits) / trials
+}
+
+func testFilter(t *testing.T, name string, f membership) {
+	for _, cidr := range []string{"10.1.2.3", "10.2.0.0/16", "10.3.0.0/20", "10.4.5.0/24"} {
+		if err := f.AddCIDR(cidr); err != nil {
+			t.Fatalf("%s: AddCIDR(%s) failed: %s", name, cidr, err)
+		}
+	}
+	for _, dots := range []string{"10.1.2.3", "10.2.0.0", "10.2.255.255", "10.3.15.1", "10.4.5.99"} {
+		if !f.ContainsDots(dots) {
+			t.Errorf("%s: missing %s", name, dots)
+		}
+	}
+	if f.ContainsDots("junk") {
+		t.Errorf("%s: matched junk", name)
+	}
+	if err := f.AddCIDR("junk"); err == nil {
+		t.Errorf("%s: Expected error on bad CIDR", name)
+	}
+	if got := fpRate(f, rand.New(rand.NewSource(1))); got > 0.02 {
+		t.Errorf("%s: false positive rate %.4f", name, got)
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	f, err := NewBloomFilter(1000, 0.01, 16, 24)
+	if err != nil {
+		t.Fatalf("NewBloomFilter failed: %s", err)
+	}
+	testFilter(t, "bloom", f)
+
+	data, _ := f.MarshalBinary()
+	var back BloomFilter
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+	if !back.ContainsDots("10.3.0.1") || back.ContainsDots("10.3.16.0") != f.ContainsDots("10.3.16.0") {
+		t.Errorf("round trip lost data")
+	}
+	for i := 0; i < len(data); i++ {
+		if back.UnmarshalBinary(data[:i]) == nil {
+			t.Errorf("accepted %d of %d bytes", i, len(data))
+		}
+	}
+	if err := back.UnmarshalBinary(append(data, 0)); err == nil {
+		t.Errorf("accepted trailing data")
+	}
+
+	// with only /32 stored a /8 is too many addresses
+	small, _ := NewBloomFilter(10, 0.01)
+	if err := small.AddCIDR("10.0.0.0/8"); err == nil {
+		t.Errorf("Expected error on huge CIDR")
+	}
+	if _, err := NewBloomFilter(10, 0, 24); err == nil {
+		t.Errorf("Expected error on zero rate")
+	}
+	if _, err := NewBloomFilter(10, 0.1, 33); err == nil {
+		t.Errorf("Expected error on length 33")
+	}
+}
+
+func TestCuckooFilter(t *testing.T) {
+	f, err := NewCuckooFilter(1000, 0.01, 16, 24)
+	if err != nil {
+		t.Fatalf("NewCuckooFilter failed: %s", err)
+	}
+	testFilter(t, "cuckoo", f)
+	// 1 + 1 + 16 + 1
+	if f.Len() != 19 {
+		t.Errorf("Len = %d, want 19", f.Len())
+	}
+
+	data, _ := f.MarshalBinary()
+	var back CuckooFilter
+	if err := back.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %s", err)
+	}
+	if back.Len() != f.Len() || !back.ContainsDots("10.3.0.1") {
+		t.Errorf("round trip lost data")
+	}
+	for i := 0; i < len(data); i++ {
+		if back.UnmarshalBinary(data[:i]) == nil {
+			t.Errorf("accepted %d of %d bytes", i, len(data))
+		}
+	}
+
+	if err := f.DeleteCIDR("10.3.0.0/20"); err != nil {
+		t.Fatalf("DeleteCIDR failed: %s", err)
+	}
+	if f.ContainsDots("10.3.0.1") {
+		t.Errorf("deleted CIDR still matched")
+	}
+	if !f.Delete(0x0A010203) || f.ContainsDots("10.1.2.3") {
+		t.Errorf("Delete failed")
+	}
+	if f.Delete(0x0A010203) {
+		t.Errorf("Delete of missing address succeeded")
+	}
+	if err := f.DeleteCIDR("10.9.0.0/24"); err == nil {
+		t.Errorf("Expected error deleting missing CIDR")
+	}
+	if err := f.DeleteCIDR("junk"); err == nil {
+		t.Errorf("Expected error on bad CIDR")
+	}
+	if !f.ContainsDots("10.2.3.4") || f.Len() != 2 {
+		t.Errorf("Len = %d after deletes, want 2", f.Len())
+	}
+}
+
+func TestCuckooFilterFull(t *testing.T) {
+	f, _ := NewCuckooFilter(8, 0.01)
+	var added []uint32
+	var err error
+	for i := uint32(0); err == nil; i++ {
+		if err = f.Add(i); err == nil {
+			added = append(added, i)
+		}
+	}
+	if err != ErrFilterFull {
+		t.Fatalf("Add = %v, want ErrFilterFull", err)
+	}
+	// nothing that was added is lost, including the victim
+	for _, addr := range added {
+		if !f.Contains(addr) {
+			t.Errorf("lost %d of %d", addr, len(added))
+		}
+	}
+	if f.Len() != len(added) {
+		t.Errorf("Len = %d, want %d", f.Len(), len(added))
+	}
+	// deleting makes room for the victim again
+	f.Delete(added[0])
+	if err := f.Add(1000); err != nil {
+		t.Errorf("Add after Delete = %v", err)
+	}
+	for _, addr := range added[1:] {
+		if !f.Contains(addr) {
+			t.Errorf("lost %d after delete", addr)
+		}
+	}
+}
+
+func TestCuckooFilterBadHeader(t *testing.T) {
+	f, _ := NewCuckooFilter(10, 0.01, 32)
+	data, _ := f.MarshalBinary()
+	header := len(data) - len(f.slots)*2 - 35
+
+	cases := []struct {
+		name string
+		edit func([]byte) []byte
+	}{
+		{"huge bucket count", func(d []byte) []byte {
+			binary.BigEndian.PutUint64(d[header:], 1<<62)
+			binary.BigEndian.PutUint64(d[header+8:], 0)
+			return d[:header+35]
+		}},
+		{"too many buckets", func(d []byte) []byte {
+			binary.BigEndian.PutUint64(d[header:], uint64(len(f.slots)/cuckooSlots*2))
+			return d
+		}},
+		{"victim flag", func(d []byte) []byte {
+			d[header+24] = 2
+			return d
+		}},
+		{"victim index", func(d []byte) []byte {
+			binary.BigEndian.PutUint64(d[header+25:], uint64(len(f.slots)))
+			return d
+		}},
+		{"victim fingerprint", func(d []byte) []byte {
+			binary.BigEndian.PutUint16(d[header+33:], 1<<f.fpBits)
+			return d
+		}},
+		{"empty victim", func(d []byte) []byte {
+			d[header+24] = 1
+			return d
+		}},
+	}
+	for _, c := range cases {
+		var back CuckooFilter
+		bad := c.edit(append([]byte(nil), data...))
+		if err := back.UnmarshalBinary(bad); err == nil {
+			t.Errorf("%s: expected error", c.name)
+		}
+	}
+}
+
+func TestFilterBuilders(t *testing.T) {
+	s := NewSet(0)
+	s.AddAll([]string{"1.2.3.4", "5.6.7.8", "9.9.9.9"})
+	m := NewIntervalMap(0)
+	m.Add("10.0.0.0/23", true)
+	m.Add("10.1.0.0/28", true)
+	m.AddRange("10.2.0.1", "10.2.0.2", true)
+
+	bs, err := BloomFilterFromSet(s, 0.001)
+	if err != nil || !bs.ContainsDots("5.6.7.8") {
+		t.Errorf("BloomFilterFromSet = %v", err)
+	}
+	cs, err := CuckooFilterFromSet(s, 0.001)
+	if err != nil || !cs.ContainsDots("5.6.7.8") || cs.Len() != 3 {
+		t.Errorf("CuckooFilterFromSet = %v", err)
+	}
+
+	bm, err := BloomFilterFromIntervalMap(m, 0.001, 24)
+	if err != nil {
+		t.Fatalf("BloomFilterFromIntervalMap failed: %s", err)
+	}
+	cm, err := CuckooFilterFromIntervalMap(m, 0.001, 24)
+	if err != nil {
+		t.Fatalf("CuckooFilterFromIntervalMap failed: %s", err)
+	}
+	// two /24s, 16 addresses and 2 addresses
+	if cm.Len() != 20 {
+		t.Errorf("Len = %d, want 20", cm.Len())
+	}
+	for _, f := range []membership{bm, cm} {
+		for _, dots := range []string{"10.0.1.200", "10.1.0.15", "10.2.0.2"} {
+			if !f.ContainsDots(dots) {
+				t.Errorf("missing %s", dots)
+			}
+		}
+	}
+
+	if _, err := BloomFilterFromIntervalMap(m, 0.001, 33); err == nil {
+		t.Errorf("Expected error on length 33")
+	}
+	huge := NewIntervalMap(0)
+	huge.insert(0, 0xFFFFFFFF, true)
+	if _, err := CuckooFilterFromIntervalMap(huge, 0.001); err == nil {
+		t.Errorf("Expected error on huge map")
+	}
+}
@@ -0,0 +1,269 @@
+package ipv4
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FirewallFormat is an output format of FirewallWriter
+type FirewallFormat int
+
+// Firewall formats
+const (
+	// FirewallIpset is input for "ipset restore", hash:net sets
+	FirewallIpset FirewallFormat = iota
+
+	// FirewallNftables is input for "nft -f", named sets with the
+	// interval flag
+	FirewallNftables
+
+	// FirewallIptables is input for "iptables-restore", one rule per
+	// network in its own chain
+	FirewallIptables
+
+	// FirewallPF is pf.conf table definitions
+	FirewallPF
+)
+
+// DefaultIpsetMaxElements is the default maxelem of an ipset
+const DefaultIpsetMaxElements = 65536
+
+// FirewallWriter writes the networks of an IntervalMap or Set as firewall
+// configuration.  Intervals are coalesced and written as the minimal list
+// of CIDRs from Interval2CIDRs.
+//
+//	fw := ipv4.FirewallWriter{Format: ipv4.FirewallIpset, Name: "drop"}
+//	err := fw.Write(os.Stdout, m)
+//
+// Lists longer than MaxElements are split into several sets, named
+// "drop_1", "drop_2" and so on, each of which must be referenced by the
+// firewall rules.
+type FirewallWriter struct {
+	Format FirewallFormat
+
+	// Name is the set, table or chain name, "blocklist" if empty
+	Name string
+
+	// Table is the nftables table, "filter" if empty.  It is in the inet
+	// family.
+	Table string
+
+	// Target is the iptables jump target, "DROP" if empty
+	Target string
+
+	// MaxElements is the most networks per set.  0 means
+	// DefaultIpsetMaxElements for ipset and no limit for the others.  It
+	// is not used for iptables.
+	MaxElements int
+
+	// Match selects the intervals to write by value, nil writes all
+	Match func(value interface{}) bool
+}
+
+// Write writes the networks of an interval map
+func (fw FirewallWriter) Write(out io.Writer, m *IntervalMap) error {
+	var prefixes []Prefix
+	var left, right uint32
+	open := false
+	flush := func() {
+		if open {
+			prefixes = appendCIDRs(prefixes, left, right)
+		}
+	}
+	for _, val := range m.Intervals {
+		if fw.Match != nil && !fw.Match(val.Value) {
+			continue
+		}
+		if open && right != 0xFFFFFFFF && val.Left == right+1 {
+			right = val.Right
+			continue
+		}
+		flush()
+		left, right, open = val.Left, val.Right, true
+	}
+	flush()
+	return fw.write(out, prefixes)
+}
+
+// WriteSet writes the addresses of a set, runs of consecutive addresses
+// are written as networks
+func (fw FirewallWriter) WriteSet(out io.Writer, s Set) error {
+	var prefixes []Prefix
+	for i := 0; i < len(s); {
+		j := i
+		for j+1 < len(s) && s[j+1] == s[j]+1 {
+			j++
+		}
+		prefixes = appendCIDRs(prefixes, s[i], s[j])
+		i = j + 1
+	}
+	return fw.write(out, prefixes)
+}
+
+// appendCIDRs appends the networks of [left, right]
+func appendCIDRs(prefixes []Prefix, left, right uint32) []Prefix {
+	Interval2CIDRs(left, right, func(addr uint32, bits byte) {
+		prefixes = append(prefixes, Prefix{Addr: addr, Bits: bits})
+	})
+	return prefixes
+}
+
+func (fw FirewallWriter) write(out io.Writer, prefixes []Prefix) error {
+	name := fw.Name
+	if name == "" {
+		name = "blocklist"
+	}
+	max := fw.MaxElements
+	if fw.Format == FirewallIpset {
+		if max == 0 {
+			max = DefaultIpsetMaxElements
+		}
+		// hash:net does not take /0, which must be split before
+		// chunking since it becomes two elements
+		if len(prefixes) == 1 && prefixes[0].Bits == 0 {
+			prefixes = []Prefix{{Addr: 0, Bits: 1}, {Addr: 0x80000000, Bits: 1}}
+		}
+	}
+
+	// chunks of at most max networks, always at least one so that an
+	// empty list still declares an empty set
+	var chunks [][]Prefix
+	if max <= 0 || fw.Format == FirewallIptables {
+		chunks = [][]Prefix{prefixes}
+	} else {
+		for len(prefixes) > max {
+			chunks = append(chunks, prefixes[:max])
+			prefixes = prefixes[max:]
+		}
+		chunks = append(chunks, prefixes)
+	}
+	names := make([]string, len(chunks))
+	for i := range chunks {
+		names[i] = name
+		if len(chunks) > 1 {
+			names[i] = fmt.Sprintf("%s_%d", name, i+1)
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	switch fw.Format {
+	case FirewallIpset:
+		if err := writeIpset(w, names, chunks, max); err != nil {
+			return err
+		}
+	case FirewallNftables:
+		table := fw.Table
+		if table == "" {
+			table = "filter"
+		}
+		writeNftables(w, table, names, chunks)
+	case FirewallIptables:
+		target := fw.Target
+		if target == "" {
+			target = "DROP"
+		}
+		writeIptables(w, name, target, chunks[0])
+	case FirewallPF:
+		writePF(w, names, chunks)
+	default:
+		return fmt.Errorf("unknown firewall format %d", fw.Format)
+	}
+	return w.Flush()
+}
+
+// ipsetMaxName is the longest ipset name
+const ipsetMaxName = 31
+
+// writeIpset writes create, flush and add commands.  The output is meant
+// for "ipset restore -exist" so that existing sets are reused.
+func writeIpset(w *bufio.Writer, names []string, chunks [][]Prefix, max int) error {
+	for _, name := range names {
+		if len(name) > ipsetMaxName {
+			return fmt.Errorf("ipset name %q is longer than %d characters", name, ipsetMaxName)
+		}
+	}
+	for i, chunk := range chunks {
+		fmt.Fprintf(w, "create %s hash:net family inet hashsize 1024 maxelem %d\n", names[i], max)
+		fmt.Fprintf(w, "flush %s\n", names[i])
+		for _, p := range chunk {
+			fmt.Fprintf(w, "add %s %s\n", names[i], hostOrCIDR(p))
+		}
+	}
+	return nil
+}
+
+// writeNftables declares the sets, flushes them and adds the elements, so
+// the output can be loaded again to replace the contents
+func writeNftables(w *bufio.Writer, table string, names []string, chunks [][]Prefix) {
+	fmt.Fprintf(w, "table inet %s {\n", table)
+	for _, name := range names {
+		fmt.Fprintf(w, "\tset %s {\n\t\ttype ipv4_addr\n\t\tflags interval\n\t}\n", name)
+	}
+	fmt.Fprintf(w, "}\n")
+	for i, chunk := range chunks {
+		fmt.Fprintf(w, "flush set inet %s %s\n", table, names[i])
+		if len(chunk) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "add element inet %s %s {\n", table, names[i])
+		for j, p := range chunk {
+			sep := ","
+			if j == len(chunk)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(w, "\t%s%s\n", hostOrCIDR(p), sep)
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+}
+
+// writeIptables writes a filter table with a chain of the networks.  The
+// chain still has to be jumped to, for instance from INPUT.
+func writeIptables(w *bufio.Writer, chain, target string, prefixes []Prefix) {
+	fmt.Fprintf(w, "*filter\n:%s - [0:0]\n", chain)
+	for _, p := range prefixes {
+		fmt.Fprintf(w, "-A %s -s %s -j %s\n", chain, p, target)
+	}
+	fmt.Fprintf(w, "COMMIT\n")
+}
+
+// writePF writes one persistent table per chunk
+func writePF(w *bufio.Writer, names []string, chunks [][]Prefix) {
+	for i, chunk := range chunks {
+		if len(chunk) == 0 {
+			fmt.Fprintf(w, "table <%s> persist\n", names[i])
+			continue
+		}
+		fmt.Fprintf(w, "table <%s> persist { \\\n", names[i])
+		for _, p := range chunk {
+			fmt.Fprintf(w, "\t%s \\\n", hostOrCIDR(p))
+		}
+		fmt.Fprintf(w, "}\n")
+	}
+}
+
+// hostOrCIDR writes a /32 as a plain address
+func hostOrCIDR(p Prefix) string {
+	if p.Bits == 32 {
+		return ToDots(p.Addr)
+	}
+	return p.String()
+}
+
+// ParseFirewallFormat returns the format named "ipset", "nftables" (or
+// "nft"), "iptables" or "pf"
+func ParseFirewallFormat(name string) (FirewallFormat, error) {
+	switch strings.ToLower(name) {
+	case "ipset":
+		return FirewallIpset, nil
+	case "nftables", "nft":
+		return FirewallNftables, nil
+	case "iptables":
+		return FirewallIptables, nil
+	case "pf":
+		return FirewallPF, nil
+	}
+	return 0, fmt.Errorf("unknown firewall format %q", name)
+}
@@ -0,0 +1,163 @@
+package ipv4
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testFirewallMap() *IntervalMap {
+	m := NewIntervalMap(10)
+	m.AddRange("10.0.0.0", "10.0.0.255", "drop")
+	m.AddRange("10.0.1.0", "10.0.1.255", "reject")
+	m.AddRange("10.0.3.0", "10.0.3.4", "drop")
+	m.AddRange("192.0.2.7", "192.0.2.7", "allow")
+	return m
+}
+
+func TestFirewallWriter(t *testing.T) {
+	notAllowed := func(v interface{}) bool { return v != "allow" }
+	cases := []struct {
+		fw   FirewallWriter
+		want string
+	}{
+		{FirewallWriter{Format: FirewallIpset, Match: notAllowed},
+			"create blocklist hash:net family inet hashsize 1024 maxelem 65536\n" +
+				"flush blocklist\n" +
+				"add blocklist 10.0.0.0/23\n" +
+				"add blocklist 10.0.3.0/30\n" +
+				"add blocklist 10.0.3.4\n"},
+		{FirewallWriter{Format: FirewallNftables, Name: "bad", Match: notAllowed},
+			"table inet filter {\n" +
+				"\tset bad {\n\t\ttype ipv4_addr\n\t\tflags interval\n\t}\n" +
+				"}\n" +
+				"flush set inet filter bad\n" +
+				"add element inet filter bad {\n" +
+				"\t10.0.0.0/23,\n\t10.0.3.0/30,\n\t10.0.3.4\n" +
+				"}\n"},
+		{FirewallWriter{Format: FirewallIptables, Target: "REJECT", Match: notAllowed},
+			"*filter\n" +
+				":blocklist - [0:0]\n" +
+				"-A blocklist -s 10.0.0.0/23 -j REJECT\n" +
+				"-A blocklist -s 10.0.3.0/30 -j REJECT\n" +
+				"-A blocklist -s 10.0.3.4/32 -j REJECT\n" +
+				"COMMIT\n"},
+		{FirewallWriter{Format: FirewallPF},
+			"table <blocklist> persist { \\\n" +
+				"\t10.0.0.0/23 \\\n\t10.0.3.0/30 \\\n\t10.0.3.4 \\\n\t192.0.2.7 \\\n" +
+				"}\n"},
+	}
+	for _, tt := range cases {
+		buf := bytes.Buffer{}
+		if err := tt.fw.Write(&buf, testFirewallMap()); err != nil {
+			t.Fatalf("format %d: %s", tt.fw.Format, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("format %d: expected\n%s\ngot\n%s", tt.fw.Format, tt.want, buf.String())
+		}
+	}
+}
+
+func TestFirewallWriterChunks(t *testing.T) {
+	fw := FirewallWriter{Format: FirewallPF, Name: "bl", MaxElements: 2}
+	buf := bytes.Buffer{}
+	if err := fw.Write(&buf, testFirewallMap()); err != nil {
+		t.Fatal(err)
+	}
+	want := "table <bl_1> persist { \\\n\t10.0.0.0/23 \\\n\t10.0.3.0/30 \\\n}\n" +
+		"table <bl_2> persist { \\\n\t10.0.3.4 \\\n\t192.0.2.7 \\\n}\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+
+	// chunked ipset output reads back as the same networks
+	fw = FirewallWriter{Format: FirewallIpset, MaxElements: 3}
+	buf.Reset()
+	if err := fw.Write(&buf, testFirewallMap()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "create blocklist_2 hash:net family inet hashsize 1024 maxelem 3\n") {
+		t.Errorf("missing second set:\n%s", buf.String())
+	}
+	m := NewIntervalMap(10)
+	diags, err := LoadBlocklist(&buf, m, true)
+	if err != nil || len(diags) != 0 {
+		t.Fatalf("LoadBlocklist failed: %v %v", err, diags)
+	}
+	if m.Len() != 3 || m.Contains("10.0.1.255") != true || m.Contains("10.0.3.5") != nil {
+		t.Errorf("unexpected round trip:\n%s", m)
+	}
+}
+
+func TestFirewallWriterSet(t *testing.T) {
+	s := NewSet(10)
+	s.AddAll([]string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.9"})
+	buf := bytes.Buffer{}
+	if err := (FirewallWriter{Format: FirewallIptables}).WriteSet(&buf, s); err != nil {
+		t.Fatal(err)
+	}
+	want := "*filter\n:blocklist - [0:0]\n" +
+		"-A blocklist -s 10.0.0.1/32 -j DROP\n" +
+		"-A blocklist -s 10.0.0.2/31 -j DROP\n" +
+		"-A blocklist -s 10.0.0.9/32 -j DROP\n" +
+		"COMMIT\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestFirewallWriterEdges(t *testing.T) {
+	m := NewIntervalMap(1)
+	if err := m.insert(0, 0xFFFFFFFF, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Valid(); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.Buffer{}
+	if err := (FirewallWriter{}).Write(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "add blocklist 0.0.0.0/1\nadd blocklist 128.0.0.0/1\n") {
+		t.Errorf("expected /0 split in two:\n%s", buf.String())
+	}
+
+	// the halves of the /0 are separate elements when chunking
+	buf.Reset()
+	if err := (FirewallWriter{MaxElements: 1}).Write(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	want := "create blocklist_1 hash:net family inet hashsize 1024 maxelem 1\n" +
+		"flush blocklist_1\n" +
+		"add blocklist_1 0.0.0.0/1\n" +
+		"create blocklist_2 hash:net family inet hashsize 1024 maxelem 1\n" +
+		"flush blocklist_2\n" +
+		"add blocklist_2 128.0.0.0/1\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+
+	buf.Reset()
+	if err := (FirewallWriter{Format: FirewallNftables}).Write(&buf, NewIntervalMap(0)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "add element") {
+		t.Errorf("empty set should have no elements:\n%s", buf.String())
+	}
+
+	long := FirewallWriter{Name: strings.Repeat("x", 32)}
+	if err := long.Write(&buf, testFirewallMap()); err == nil {
+		t.Errorf("expected error for long ipset name")
+	}
+	if err := (FirewallWriter{Format: 99}).Write(&buf, testFirewallMap()); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+	for _, name := range []string{"ipset", "nft", "NFTABLES", "iptables", "pf"} {
+		if _, err := ParseFirewallFormat(name); err != nil {
+			t.Errorf("ParseFirewallFormat(%q) failed: %s", name, err)
+		}
+	}
+	if _, err := ParseFirewallFormat("ipfw"); err == nil {
+		t.Errorf("expected error for ipfw")
+	}
+}
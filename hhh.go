@@ -0,0 +1,224 @@
+package ipv4
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// HeavyHitter is a prefix reported by HeavyHitters.Query
+type HeavyHitter struct {
+	Prefix uint32
+	Bits   byte
+
+	// Count is the estimated number of addresses seen in the prefix.  It
+	// may be over by up to Error.
+	Count uint64
+	Error uint64
+
+	// Discounted is Count less the counts of the heavy hitters reported
+	// inside this prefix
+	Discounted uint64
+}
+
+// CIDR returns the prefix in CIDR notation
+func (h HeavyHitter) CIDR() string {
+	return fmt.Sprintf("%s/%d", ToDots(h.Prefix), h.Bits)
+}
+
+func (h HeavyHitter) String() string {
+	return fmt.Sprintf("%s=%d", h.CIDR(), h.Discounted)
+}
+
+// HeavyHitters finds the prefixes that account for more than a fraction
+// of a stream of addresses, the hierarchical heavy hitters problem.
+//
+// Each prefix length keeps a fixed number of space-saving counters, so
+// memory is bounded no matter how many distinct addresses are seen.  With
+// capacity c per level, counts are over-estimated by at most total/c.
+//
+//	hh := ipv4.NewHeavyHitters(1000, 8, 16, 24, 32)
+//	for _, addr := range stream {
+//		hh.Add(addr)
+//	}
+//	for _, h := range hh.Query(0.05) {
+//		fmt.Println(h.CIDR(), h.Discounted)
+//	}
+type HeavyHitters struct {
+	levels []*spaceSaving
+	total  uint64
+}
+
+// NewHeavyHitters creates a HeavyHitters with capacity counters for each
+// prefix length.  With no lengths given it uses /8, /16, /24 and /32.
+func NewHeavyHitters(capacity int, bits ...byte) *HeavyHitters {
+	if len(bits) == 0 {
+		bits = []byte{8, 16, 24, 32}
+	}
+	if capacity < 1 {
+		capacity = 1
+	}
+	sorted := append([]byte(nil), bits...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+	h := &HeavyHitters{}
+	for i, b := range sorted {
+		if b > 32 || (i > 0 && b == sorted[i-1]) {
+			continue
+		}
+		h.levels = append(h.levels, newSpaceSaving(b, capacity))
+	}
+	return h
+}
+
+// Add counts one occurrence of an address
+func (h *HeavyHitters) Add(addr uint32) {
+	h.AddN(addr, 1)
+}
+
+// AddN counts n occurrences of an address
+func (h *HeavyHitters) AddN(addr uint32, n uint64) {
+	h.total += n
+	for _, level := range h.levels {
+		level.add(Mask(addr, level.bits), n)
+	}
+}
+
+// Total returns the number of occurrences counted
+func (h *HeavyHitters) Total() uint64 {
+	return h.total
+}
+
+// Query returns the minimal set of prefixes whose discounted count is at
+// least phi of the total.  Prefixes are considered from the longest up,
+// and a shorter prefix is reported only if it is heavy without the
+// heavy hitters already reported inside it.  The result is sorted by
+// address and then prefix length.
+func (h *HeavyHitters) Query(phi float64) []HeavyHitter {
+	threshold := phi * float64(h.total)
+	var out []HeavyHitter
+	for _, level := range h.levels {
+		var found []HeavyHitter
+		for _, e := range level.entries {
+			if float64(e.count) < threshold {
+				continue
+			}
+			cand := HeavyHitter{Prefix: e.key, Bits: level.bits, Count: e.count, Error: e.err}
+			if d := discount(cand, out); d < cand.Count {
+				cand.Discounted = cand.Count - d
+			}
+			if float64(cand.Discounted) >= threshold {
+				found = append(found, cand)
+			}
+		}
+		out = append(out, found...)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Prefix != out[j].Prefix {
+			return out[i].Prefix < out[j].Prefix
+		}
+		return out[i].Bits < out[j].Bits
+	})
+	return out
+}
+
+// discount sums the counts of the outermost reported prefixes inside p
+func discount(p HeavyHitter, reported []HeavyHitter) uint64 {
+	var sum uint64
+	for i, r := range reported {
+		if !prefixCovers(p.Prefix, p.Bits, r.Prefix) {
+			continue
+		}
+		outer := true
+		for j, o := range reported {
+			if j != i && o.Bits < r.Bits && prefixCovers(o.Prefix, o.Bits, r.Prefix) {
+				outer = false
+				break
+			}
+		}
+		if outer {
+			sum += r.Count
+		}
+	}
+	return sum
+}
+
+// prefixCovers returns true if addr is in prefix/bits
+func prefixCovers(prefix uint32, bits byte, addr uint32) bool {
+	return Mask(addr, bits) == prefix
+}
+
+// spaceSaving is the Space-Saving algorithm of Metwally, Agrawal and
+// El Abbadi: a fixed number of counters where a new key replaces the
+// smallest counter and inherits its count as error
+type spaceSaving struct {
+	bits    byte
+	max     int
+	index   map[uint32]*ssEntry
+	entries ssHeap
+}
+
+type ssEntry struct {
+	key   uint32
+	count uint64
+	err   uint64
+	pos   int
+}
+
+func newSpaceSaving(bits byte, capacity int) *spaceSaving {
+	return &spaceSaving{
+		bits:  bits,
+		max:   capacity,
+		index: make(map[uint32]*ssEntry, capacity),
+	}
+}
+
+func (s *spaceSaving) add(key uint32, n uint64) {
+	if e, ok := s.index[key]; ok {
+		e.count += n
+		heap.Fix(&s.entries, e.pos)
+		return
+	}
+	if len(s.entries) < s.max {
+		e := &ssEntry{key: key, count: n}
+		s.index[key] = e
+		heap.Push(&s.entries, e)
+		return
+	}
+	e := s.entries[0]
+	delete(s.index, e.key)
+	e.key = key
+	e.err = e.count
+	e.count += n
+	s.index[key] = e
+	heap.Fix(&s.entries, 0)
+}
+
+// ssHeap is a min-heap of counters
+type ssHeap []*ssEntry
+
+func (h ssHeap) Len() int {
+	return len(h)
+}
+
+func (h ssHeap) Less(i, j int) bool {
+	return h[i].count < h[j].count
+}
+
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].pos = i
+	h[j].pos = j
+}
+
+func (h *ssHeap) Push(x interface{}) {
+	e := x.(*ssEntry)
+	e.pos = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *ssHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,109 @@
+package ipv4
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestHeavyHitters(t *testing.T) {
+	hh := NewHeavyHitters(64)
+	r := rand.New(rand.NewSource(1))
+
+	// 30% from one host, 30% spread over a /24, 20% spread over a /16
+	// and 20% noise
+	for i := 0; i < 10000; i++ {
+		switch x := r.Intn(10); {
+		case x < 3:
+			hh.Add(0x01020304)
+		case x < 6:
+			hh.Add(0x0A000100 | uint32(r.Intn(256)))
+		case x < 8:
+			hh.Add(0xC0A80000 | uint32(r.Intn(65536)))
+		default:
+			hh.Add(r.Uint32())
+		}
+	}
+	if hh.Total() != 10000 {
+		t.Errorf("Total = %d, want 10000", hh.Total())
+	}
+
+	got := hh.Query(0.1)
+	var cidrs []string
+	for _, h := range got {
+		cidrs = append(cidrs, h.CIDR())
+	}
+	want := []string{"1.2.3.4/32", "10.0.1.0/24", "192.168.0.0/16"}
+	if !reflect.DeepEqual(cidrs, want) {
+		t.Fatalf("Query(0.1) = %v, want %v", got, want)
+	}
+	for _, h := range got {
+		if h.Count < 1800 || h.Discounted < 1000 || h.Discounted > h.Count {
+			t.Errorf("%s has count %d, discounted %d", h.CIDR(), h.Count, h.Discounted)
+		}
+	}
+}
+
+func TestHeavyHittersDiscount(t *testing.T) {
+	hh := NewHeavyHitters(16, 32, 24, 16, 24)
+	for i := 0; i < 40; i++ {
+		hh.AddN(0x0A000001, 1)
+	}
+	for i := 0; i < 30; i++ {
+		hh.Add(0x0A000002 + uint32(i))
+	}
+	for i := 0; i < 30; i++ {
+		hh.Add(0x0A000100 + uint32(i))
+	}
+
+	// both /24s are heavy without the host, leaving nothing for the /16
+	got := hh.Query(0.25)
+	want := []HeavyHitter{
+		{Prefix: 0x0A000000, Bits: 24, Count: 70, Discounted: 30},
+		{Prefix: 0x0A000001, Bits: 32, Count: 40, Discounted: 40},
+		{Prefix: 0x0A000100, Bits: 24, Count: 30, Discounted: 30},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query(0.25) = %v, want %v", got, want)
+	}
+	// at 35% neither /24 is heavy on its own, so the /16 is
+	got = hh.Query(0.35)
+	want = []HeavyHitter{
+		{Prefix: 0x0A000000, Bits: 16, Count: 100, Discounted: 60},
+		{Prefix: 0x0A000001, Bits: 32, Count: 40, Discounted: 40},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Query(0.35) = %v, want %v", got, want)
+	}
+	if s := got[0].String(); s != "10.0.0.0/16=60" {
+		t.Errorf("String = %s", s)
+	}
+}
+
+func TestSpaceSavingBounds(t *testing.T) {
+	s := newSpaceSaving(32, 4)
+	for i := uint32(0); i < 100; i++ {
+		s.add(i, 1)
+	}
+	s.add(7, 50)
+	if len(s.entries) != 4 || len(s.index) != 4 {
+		t.Fatalf("space saving grew to %d entries", len(s.entries))
+	}
+	e := s.index[7]
+	if e == nil || e.count < 50 || e.count-e.err > 50 {
+		t.Errorf("heavy key not tracked: %+v", e)
+	}
+}
+
+func BenchmarkHeavyHitters(b *testing.B) {
+	hh := NewHeavyHitters(1000)
+	r := rand.New(rand.NewSource(1))
+	addrs := make([]uint32, 4096)
+	for i := range addrs {
+		addrs[i] = r.Uint32() & 0xFF00FFFF
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		hh.Add(addrs[i&4095])
+	}
+}
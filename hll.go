@@ -0,0 +1,288 @@
+package ipv4
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// HLL estimates the number of distinct addresses, or distinct prefixes,
+// in bounded memory with a HyperLogLog sketch.
+//
+// Small counts are exact: addresses are kept in a Set until it would
+// take more memory than the sketch's 2^Precision registers, then the
+// sketch takes over.  The estimate uses Ertl's improved estimator, which
+// needs no empirical bias correction and has a standard error of about
+// 1.04/sqrt(2^Precision), 0.8% at the default precision of 14.
+//
+// Sketches of the same precision and prefix length can be merged, for
+// example across shards, and serialized with MarshalBinary.
+type HLL struct {
+	precision  byte
+	prefixBits byte
+	exact      Set
+	registers  []byte // nil while exact
+}
+
+// DefaultHLLPrecision uses 16KB of registers per sketch
+const DefaultHLLPrecision = 14
+
+// ErrHLLMismatch is returned when merging sketches of a different
+// precision or prefix length
+var ErrHLLMismatch = errors.New("HLL precision or prefix length differ")
+
+// NewHLL creates a sketch with 2^precision registers, precision being
+// 4 to 18.  prefixBits counts distinct prefixes of that length instead
+// of distinct addresses, 24 counts distinct /24s; 0 means 32.
+func NewHLL(precision, prefixBits byte) (*HLL, error) {
+	if precision < 4 || precision > 18 {
+		return nil, fmt.Errorf("HLL precision %d not in [4, 18]", precision)
+	}
+	if prefixBits == 0 {
+		prefixBits = 32
+	}
+	if prefixBits > 32 {
+		return nil, fmt.Errorf("HLL prefix length %d over 32", prefixBits)
+	}
+	return &HLL{precision: precision, prefixBits: prefixBits}, nil
+}
+
+// Precision returns the log2 of the number of registers
+func (h *HLL) Precision() byte {
+	return h.precision
+}
+
+// PrefixBits returns the prefix length being counted
+func (h *HLL) PrefixBits() byte {
+	return h.prefixBits
+}
+
+// Add counts an address
+func (h *HLL) Add(addr uint32) {
+	key := Mask(addr, h.prefixBits)
+	if h.registers != nil {
+		h.addHash(hllHash(key))
+		return
+	}
+	h.exact.add(key)
+	if len(h.exact) > h.exactLimit() {
+		h.toSketch()
+	}
+}
+
+// AddDots counts a dotted address
+func (h *HLL) AddDots(dots string) error {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return err
+	}
+	h.Add(addr)
+	return nil
+}
+
+// AddSet counts every address of a Set
+func (h *HLL) AddSet(s Set) {
+	for _, addr := range s {
+		h.Add(addr)
+	}
+}
+
+// Count returns the number of distinct addresses or prefixes
+func (h *HLL) Count() uint64 {
+	if h.registers == nil {
+		return uint64(len(h.exact))
+	}
+	return h.estimate()
+}
+
+// Exact returns the distinct addresses or prefixes while the count is
+// still exact, or false once the sketch is in use
+func (h *HLL) Exact() (Set, bool) {
+	if h.registers != nil {
+		return nil, false
+	}
+	return append(Set(nil), h.exact...), true
+}
+
+// Merge adds the contents of other, which must have the same precision
+// and prefix length
+func (h *HLL) Merge(other *HLL) error {
+	if h.precision != other.precision || h.prefixBits != other.prefixBits {
+		return ErrHLLMismatch
+	}
+	if other.registers == nil {
+		for _, key := range other.exact {
+			h.Add(key)
+		}
+		return nil
+	}
+	if h.registers == nil {
+		h.toSketch()
+	}
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+	return nil
+}
+
+// exactLimit is the largest exact set, the point at which it would use
+// more memory than the registers
+func (h *HLL) exactLimit() int {
+	return (1 << h.precision) / 4
+}
+
+func (h *HLL) toSketch() {
+	h.registers = make([]byte, 1<<h.precision)
+	for _, key := range h.exact {
+		h.addHash(hllHash(key))
+	}
+	h.exact = nil
+}
+
+func (h *HLL) addHash(x uint64) {
+	p := uint(h.precision)
+	rank := byte(bits.LeadingZeros64(x<<p)) + 1
+	if max := byte(65 - p); rank > max {
+		rank = max
+	}
+	if i := x >> (64 - p); rank > h.registers[i] {
+		h.registers[i] = rank
+	}
+}
+
+// estimate is the improved raw estimator of Ertl, "New cardinality
+// estimation algorithms for HyperLogLog sketches" (2017)
+func (h *HLL) estimate() uint64 {
+	p := int(h.precision)
+	q := 64 - p
+	m := float64(len(h.registers))
+	var counts [66]float64
+	for _, r := range h.registers {
+		counts[r]++
+	}
+	if counts[0] == m {
+		return 0
+	}
+	z := m * hllTau((m-counts[q+1])/m)
+	for k := q; k >= 1; k-- {
+		z = 0.5 * (z + counts[k])
+	}
+	z += m * hllSigma(counts[0]/m)
+	return uint64(math.Round(m * m / (2 * math.Ln2) / z))
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= (1 - x) * (1 - x) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
+
+// hllHash spreads a key over 64 bits with the splitmix64 finalizer.  It
+// must never change, or serialized sketches would no longer merge.
+func hllHash(key uint32) uint64 {
+	return mix64(uint64(key))
+}
+
+const hllVersion = 1
+
+// MarshalBinary encodes the sketch: a version byte, the precision, the
+// prefix length, then either 0 and the delta encoded exact keys or 1 and
+// the registers
+func (h *HLL) MarshalBinary() ([]byte, error) {
+	out := []byte{hllVersion, h.precision, h.prefixBits}
+	if h.registers != nil {
+		out = append(out, 1)
+		return append(out, h.registers...), nil
+	}
+	out = append(out, 0)
+	var tmp [binary.MaxVarintLen64]byte
+	out = append(out, tmp[:binary.PutUvarint(tmp[:], uint64(len(h.exact)))]...)
+	last := uint32(0)
+	for _, key := range h.exact {
+		out = append(out, tmp[:binary.PutUvarint(tmp[:], uint64(key-last))]...)
+		last = key
+	}
+	return out, nil
+}
+
+// UnmarshalBinary decodes a sketch written by MarshalBinary
+func (h *HLL) UnmarshalBinary(data []byte) error {
+	bad := errors.New("invalid HLL encoding")
+	if len(data) < 4 || data[0] != hllVersion {
+		return bad
+	}
+	out, err := NewHLL(data[1], data[2])
+	if err != nil || out.prefixBits != data[2] {
+		return bad
+	}
+	mode, data := data[3], data[4:]
+	switch mode {
+	case 0:
+		n, size := binary.Uvarint(data)
+		if size <= 0 || n > uint64(out.exactLimit()) {
+			return bad
+		}
+		data = data[size:]
+		out.exact = make(Set, 0, n)
+		var key uint64
+		for i := uint64(0); i < n; i++ {
+			delta, size := binary.Uvarint(data)
+			if size <= 0 || (i > 0 && delta == 0) || key+delta > math.MaxUint32 {
+				return bad
+			}
+			data = data[size:]
+			key += delta
+			out.exact = append(out.exact, uint32(key))
+		}
+		if len(data) != 0 {
+			return bad
+		}
+	case 1:
+		if len(data) != 1<<out.precision {
+			return bad
+		}
+		max := 65 - out.precision
+		for _, r := range data {
+			if r > max {
+				return bad
+			}
+		}
+		out.registers = append([]byte(nil), data...)
+	default:
+		return bad
+	}
+	*h = *out
+	return nil
+}
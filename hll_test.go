@@ -0,0 +1,188 @@
+package ipv4
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestHLLExact(t *testing.T) {
+	h, err := NewHLL(DefaultHLLPrecision, 0)
+	if err != nil {
+		t.Fatalf("NewHLL failed: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		h.AddDots("1.2.3.4")
+		h.AddDots("1.2.3.5")
+	}
+	if err := h.AddDots("junk"); err == nil {
+		t.Errorf("Expected error on bad address")
+	}
+	if h.Count() != 2 {
+		t.Errorf("Count = %d, want 2", h.Count())
+	}
+	s, ok := h.Exact()
+	if !ok || len(s) != 2 || !s.Contains("1.2.3.5") || !s.Valid() {
+		t.Errorf("Exact = %v, %v", s, ok)
+	}
+
+	// exact up to the limit
+	for i := uint32(0); i < 4094; i++ {
+		h.Add(0x0A000000 + i)
+	}
+	if _, ok := h.Exact(); !ok || h.Count() != 4096 {
+		t.Errorf("Count = %d, %v, want exact 4096", h.Count(), ok)
+	}
+	h.Add(0x0B000000)
+	if _, ok := h.Exact(); ok {
+		t.Errorf("Expected sketch mode over the limit")
+	}
+}
+
+func TestHLLAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{1000, 10000, 100000, 1000000} {
+		h, _ := NewHLL(DefaultHLLPrecision, 32)
+		for i := 0; i < n; i++ {
+			h.Add(r.Uint32())
+		}
+		got := float64(h.Count())
+		if e := math.Abs(got-float64(n)) / float64(n); e > 0.03 {
+			t.Errorf("Count of %d = %.0f, error %.3f", n, got, e)
+		}
+	}
+}
+
+func TestHLLPrefixBits(t *testing.T) {
+	h, _ := NewHLL(DefaultHLLPrecision, 24)
+	if h.PrefixBits() != 24 || h.Precision() != DefaultHLLPrecision {
+		t.Errorf("PrefixBits, Precision = %d, %d", h.PrefixBits(), h.Precision())
+	}
+	s := NewSet(0)
+	for i := uint32(0); i < 1000; i++ {
+		s = append(s, 0x0A000000+i*17)
+	}
+	h.AddSet(s)
+	// 17*999 = 16983 spans 67 /24s
+	if h.Count() != 67 {
+		t.Errorf("Count = %d, want 67", h.Count())
+	}
+
+	// 20000 /24s, each seen several times
+	big, _ := NewHLL(DefaultHLLPrecision, 24)
+	for i := uint32(0); i < 100000; i++ {
+		big.Add(0x0A000000 + (i%20000)<<8 + i%7)
+	}
+	got := float64(big.Count())
+	if math.Abs(got-20000)/20000 > 0.03 {
+		t.Errorf("Count = %.0f, want about 20000", got)
+	}
+}
+
+func TestHLLMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	all, _ := NewHLL(12, 32)
+	var shards [4]*HLL
+	for i := range shards {
+		shards[i], _ = NewHLL(12, 32)
+	}
+	for i := 0; i < 50000; i++ {
+		addr := r.Uint32() & 0x0001FFFF
+		all.Add(addr)
+		shards[i%4].Add(addr)
+	}
+	small, _ := NewHLL(12, 32)
+	small.Add(1)
+	small.Add(2)
+
+	merged, _ := NewHLL(12, 32)
+	merged.Merge(small)
+	if merged.Count() != 2 {
+		t.Errorf("Count after exact merge = %d, want 2", merged.Count())
+	}
+	for _, s := range shards {
+		if err := merged.Merge(s); err != nil {
+			t.Fatalf("Merge failed: %s", err)
+		}
+	}
+	all.Add(1)
+	all.Add(2)
+	if merged.Count() != all.Count() {
+		t.Errorf("merged Count = %d, want %d", merged.Count(), all.Count())
+	}
+	if err := all.Merge(small); err != nil || merged.Count() != all.Count() {
+		t.Errorf("merging exact into sketch changed the count: %v", err)
+	}
+
+	other, _ := NewHLL(12, 24)
+	if err := merged.Merge(other); err != ErrHLLMismatch {
+		t.Errorf("Merge of different prefix = %v", err)
+	}
+	other, _ = NewHLL(13, 32)
+	if err := merged.Merge(other); err != ErrHLLMismatch {
+		t.Errorf("Merge of different precision = %v", err)
+	}
+}
+
+func TestHLLBinary(t *testing.T) {
+	for _, n := range []uint32{0, 10, 100000} {
+		h, _ := NewHLL(10, 16)
+		for i := uint32(0); i < n; i++ {
+			h.Add(i * 65536)
+		}
+		data, err := h.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary failed: %s", err)
+		}
+		var back HLL
+		if err := back.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%d) failed: %s", n, err)
+		}
+		if back.Count() != h.Count() || back.PrefixBits() != 16 || back.Precision() != 10 {
+			t.Errorf("round trip of %d: Count %d, want %d", n, back.Count(), h.Count())
+		}
+		// truncated data is rejected
+		for i := 0; i < len(data); i++ {
+			if err := back.UnmarshalBinary(data[:i]); err == nil && !(n == 0 && i == len(data)) {
+				t.Errorf("accepted %d of %d bytes", i, len(data))
+			}
+		}
+	}
+
+	bad := [][]byte{
+		{2, 10, 32, 0, 0},
+		{1, 30, 32, 0, 0},
+		{1, 10, 33, 0, 0},
+		{1, 10, 32, 2},
+		{1, 10, 32, 0, 2, 5, 0},
+		{1, 10, 32, 0, 1, 5, 0},
+	}
+	for _, data := range bad {
+		var h HLL
+		if err := h.UnmarshalBinary(data); err == nil {
+			t.Errorf("accepted %v", data)
+		}
+	}
+}
+
+func TestHLLErrors(t *testing.T) {
+	for _, p := range []byte{0, 3, 19} {
+		if _, err := NewHLL(p, 32); err == nil {
+			t.Errorf("Expected error on precision %d", p)
+		}
+	}
+	if _, err := NewHLL(10, 33); err == nil {
+		t.Errorf("Expected error on prefix length 33")
+	}
+}
+
+func BenchmarkHLLAdd(b *testing.B) {
+	h, _ := NewHLL(DefaultHLLPrecision, 32)
+	for i := uint32(0); i < 10000; i++ {
+		h.Add(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Add(uint32(i))
+	}
+}
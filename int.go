@@ -68,6 +68,45 @@ func FromDots(ipstr string) (uint32, error) {
 	return out, nil
 }
 
+// FromDotsBytes is FromDots for a byte slice.  It does not allocate,
+// so log lines can be parsed in place.
+func FromDotsBytes(ipbytes []byte) (uint32, error) {
+	var out uint32
+	var oct uint32
+	var num int
+	var hasOct bool
+
+	// same state machine as FromDots
+	for _, b := range ipbytes {
+		switch {
+		case b >= '0' && b <= '9':
+			oct = oct*10 + uint32(b-'0')
+			if oct > 255 {
+				return 0, ErrBadIP
+			}
+			hasOct = true
+		case b == '.':
+			if !hasOct {
+				return 0, ErrBadIP
+			}
+			out = (out << 8) | oct
+			oct = 0
+			hasOct = false
+			num++
+			if num > 3 {
+				return 0, ErrBadIP
+			}
+		default:
+			return 0, ErrBadIP
+		}
+	}
+	if num != 3 || !hasOct {
+		return 0, ErrBadIP
+	}
+	out = (out << 8) | oct
+	return out, nil
+}
+
 // ToDots converts a uint32 to a IPv4 Dotted notation
 //
 // About 10x faster than doing something with fmt.Sprintf
@@ -78,7 +117,22 @@ func FromDots(ipstr string) (uint32, error) {
 //
 func ToDots(p4 uint32) string {
 	const maxIPv4StringLen = len("255.255.255.255")
-	b := make([]byte, maxIPv4StringLen)
+	var b [maxIPv4StringLen]byte
+	return string(AppendDots(b[:0], p4))
+}
+
+// AppendDots appends the dotted form of an address to dst and returns
+// the extended buffer.  It does not allocate if dst has room for 15
+// more bytes.
+func AppendDots(dst []byte, p4 uint32) []byte {
+	const maxIPv4StringLen = len("255.255.255.255")
+	start := len(dst)
+	if cap(dst)-start < maxIPv4StringLen {
+		grown := make([]byte, start, start+maxIPv4StringLen)
+		copy(grown, dst)
+		dst = grown
+	}
+	b := dst[start : start+maxIPv4StringLen]
 
 	n := ubtoa(b, 0, byte(p4>>24))
 	b[n] = '.'
@@ -93,7 +147,7 @@ func ToDots(p4 uint32) string {
 	n++
 
 	n += ubtoa(b, n, byte(p4&0xFF))
-	return string(b[:n])
+	return dst[:start+n]
 }
 
 // from
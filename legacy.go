@@ -0,0 +1,172 @@
+package ipv4
+
+import (
+	"strings"
+)
+
+// LegacyForm describes the non-canonical parts of an address accepted by
+// ParseLegacy.  Several forms may be combined, as in "0x7f.1".
+type LegacyForm uint
+
+// LegacyCanonical is a plain dotted quad of decimal octets
+const LegacyCanonical LegacyForm = 0
+
+const (
+	// LegacyHex means a part was written in hex, "0x7f.0.0.1"
+	LegacyHex LegacyForm = 1 << iota
+
+	// LegacyOctal means a part had a leading zero, "0177.0.0.1"
+	LegacyOctal
+
+	// LegacyShort means fewer than four parts, "127.1" or "127.0.1"
+	LegacyShort
+
+	// LegacyInteger means a single 32 bit number, "2130706433"
+	LegacyInteger
+
+	// LegacyTrailing means whitespace and trailing text were ignored
+	LegacyTrailing
+)
+
+func (f LegacyForm) String() string {
+	if f == LegacyCanonical {
+		return "canonical"
+	}
+	var names []string
+	for _, n := range []struct {
+		form LegacyForm
+		name string
+	}{
+		{LegacyHex, "hex"},
+		{LegacyOctal, "octal"},
+		{LegacyShort, "short"},
+		{LegacyInteger, "integer"},
+		{LegacyTrailing, "trailing"},
+	} {
+		if f&n.form != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// ParseLegacy parses an address with the grammar of libc's inet_aton,
+// which unlike FromDots accepts hex ("0x7f.1"), octal ("017700000001"),
+// integer ("2130706433") and short ("127.1") forms.
+//
+// The form reports which non-canonical notations were used.  Since
+// "010.0.0.1" is octal here but decimal to FromDots, any form other than
+// LegacyCanonical is worth flagging in filters.
+func ParseLegacy(s string) (uint32, LegacyForm, error) {
+	var parts [4]uint64
+	var form LegacyForm
+	n := 0
+	i := 0
+	for {
+		// every part starts with a digit
+		if i >= len(s) || s[i] < '0' || s[i] > '9' {
+			return 0, 0, ErrBadIP
+		}
+		if n == 4 {
+			return 0, 0, ErrBadIP
+		}
+
+		base := uint64(10)
+		if s[i] == '0' && i+1 < len(s) {
+			switch {
+			case s[i+1] == 'x' || s[i+1] == 'X':
+				base = 16
+				form |= LegacyHex
+				i += 2
+			case s[i+1] >= '0' && s[i+1] <= '9':
+				base = 8
+				form |= LegacyOctal
+				i++
+			}
+		}
+
+		var val uint64
+		digits := 0
+		for ; i < len(s); i++ {
+			d, ok := legacyDigit(s[i], base)
+			if !ok {
+				break
+			}
+			val = val*base + d
+			if val > 0xFFFFFFFF {
+				return 0, 0, ErrBadIP
+			}
+			digits++
+		}
+		if digits == 0 && base == 16 {
+			return 0, 0, ErrBadIP
+		}
+		parts[n] = val
+		n++
+
+		if i < len(s) && s[i] == '.' {
+			i++
+			continue
+		}
+		break
+	}
+
+	// anything after the address must start with whitespace
+	if i < len(s) {
+		switch s[i] {
+		case ' ', '\t', '\n', '\v', '\f', '\r':
+			form |= LegacyTrailing
+		default:
+			return 0, 0, ErrBadIP
+		}
+	}
+
+	// all but the last part are single octets, the last part fills the
+	// remaining bytes
+	for _, p := range parts[:n-1] {
+		if p > 0xFF {
+			return 0, 0, ErrBadIP
+		}
+	}
+	last := parts[n-1]
+	if last > uint64(0xFFFFFFFF)>>uint(8*(n-1)) {
+		return 0, 0, ErrBadIP
+	}
+	var out uint32
+	for _, p := range parts[:n-1] {
+		out = out<<8 | uint32(p)
+	}
+	out = out<<uint(8*(5-n)) | uint32(last)
+
+	switch {
+	case n == 1:
+		form |= LegacyInteger
+	case n < 4:
+		form |= LegacyShort
+	}
+	return out, form, nil
+}
+
+func legacyDigit(c byte, base uint64) (uint64, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		d := uint64(c - '0')
+		return d, d < base
+	case base == 16 && c >= 'a' && c <= 'f':
+		return uint64(c-'a') + 10, true
+	case base == 16 && c >= 'A' && c <= 'F':
+		return uint64(c-'A') + 10, true
+	}
+	return 0, false
+}
+
+// Canonicalize rewrites any address inet_aton would accept into dotted
+// decimal form, so "0x7f.1" becomes "127.0.0.1".  Filters such as
+// IsPrivate should check the canonical form.
+func Canonicalize(s string) (string, error) {
+	addr, _, err := ParseLegacy(s)
+	if err != nil {
+		return "", err
+	}
+	return ToDots(addr), nil
+}
@@ -0,0 +1,93 @@
+package ipv4
+
+import (
+	"testing"
+)
+
+func TestParseLegacy(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		form LegacyForm
+	}{
+		{"127.0.0.1", "127.0.0.1", LegacyCanonical},
+		{"0.0.0.0", "0.0.0.0", LegacyCanonical},
+		{"255.255.255.255", "255.255.255.255", LegacyCanonical},
+		{"127.1", "127.0.0.1", LegacyShort},
+		{"127.0.1", "127.0.0.1", LegacyShort},
+		{"10.65535", "10.0.255.255", LegacyShort},
+		{"10.1.65535", "10.1.255.255", LegacyShort},
+		{"2130706433", "127.0.0.1", LegacyInteger},
+		{"4294967295", "255.255.255.255", LegacyInteger},
+		{"017700000001", "127.0.0.1", LegacyOctal | LegacyInteger},
+		{"0x7f000001", "127.0.0.1", LegacyHex | LegacyInteger},
+		{"0X7F000001", "127.0.0.1", LegacyHex | LegacyInteger},
+		{"0x7f.1", "127.0.0.1", LegacyHex | LegacyShort},
+		{"0177.0.0.01", "127.0.0.1", LegacyOctal},
+		{"010.0.0.1", "8.0.0.1", LegacyOctal},
+		{"0xa9.0xfe.0xa9.0xfe", "169.254.169.254", LegacyHex},
+		{"0xA9FEA9FE", "169.254.169.254", LegacyHex | LegacyInteger},
+		{"169.254.43518", "169.254.169.254", LegacyShort},
+		{"0251.0376.0251.0376", "169.254.169.254", LegacyOctal},
+		{"127.0.0.1 junk", "127.0.0.1", LegacyTrailing},
+		{"127.1\t", "127.0.0.1", LegacyShort | LegacyTrailing},
+	}
+	for _, tt := range tests {
+		addr, form, err := ParseLegacy(tt.in)
+		if err != nil {
+			t.Errorf("ParseLegacy(%q) error: %s", tt.in, err)
+			continue
+		}
+		if ToDots(addr) != tt.want || form != tt.form {
+			t.Errorf("ParseLegacy(%q) = %s %s, want %s %s", tt.in, ToDots(addr), form, tt.want, tt.form)
+		}
+	}
+
+	bad := []string{
+		"",
+		".1.2.3",
+		"1.2.3.",
+		"1..2",
+		"1.2.3.4.5",
+		"256.1",
+		"1.2.3.256",
+		"1.16777216",
+		"1.2.65536",
+		"4294967296",
+		"0x100000000",
+		"0x",
+		"0x.1",
+		"08",
+		"0.09.1.1",
+		"1.2.3.4x",
+		"-1.2.3.4",
+		" 1.2.3.4",
+		"+1",
+		"0xg",
+		"99999999999999999999999",
+	}
+	for _, in := range bad {
+		if addr, form, err := ParseLegacy(in); err == nil {
+			t.Errorf("ParseLegacy(%q) = %s %s, expected error", in, ToDots(addr), form)
+		}
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	got, err := Canonicalize("0x7f.1")
+	if err != nil || got != "127.0.0.1" || !IsPrivate(got) {
+		t.Errorf("Canonicalize(0x7f.1) = %q, %v", got, err)
+	}
+	if _, err := Canonicalize("example.com"); err == nil {
+		t.Errorf("Expected error on hostname")
+	}
+}
+
+func TestLegacyFormString(t *testing.T) {
+	if s := (LegacyHex | LegacyShort).String(); s != "hex|short" {
+		t.Errorf("String() = %q", s)
+	}
+	if s := LegacyCanonical.String(); s != "canonical" {
+		t.Errorf("String() = %q", s)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"reflect"
 	"sort"
 	"strings"
 )
@@ -52,7 +53,8 @@ func NewIntervalMap(capacity int) *IntervalMap {
 	}
 }
 
-// Go emits a source code representation of the data
+// Go emits a source code representation of the data.  To generate a Go
+// file from a list, with typed values, use cmd/ipv4gen.
 func (ipset IntervalMap) Go() string {
 	buf := bytes.Buffer{}
 	buf.WriteString("ipv4.IntervalMap{\n")
@@ -68,6 +70,10 @@ func (ipset IntervalMap) String() string {
 	return ipset.Intervals.String()
 }
 
+// maxIntervalSpan is the widest interval Valid accepts, coalescing stops
+// short of it so a map covering everything is two intervals
+const maxIntervalSpan = uint32(255) << 24
+
 func (ipset *IntervalMap) add(left, right uint32, value interface{}) error {
 	if left > right {
 		return fmt.Errorf("left %s > right %s",
@@ -78,6 +84,18 @@ func (ipset *IntervalMap) add(left, right uint32, value interface{}) error {
 			ToDots(left), ToDots(right))
 	}
 
+	// fast path for sorted bulk loads: the new interval lies after
+	// everything already in the set
+	if n := len(ipset.Intervals); n > 0 && left > ipset.Intervals[n-1].Right {
+		last := &ipset.Intervals[n-1]
+		if left == last.Right+1 && right-last.Left <= maxIntervalSpan && sameValue(value, last.Value) {
+			last.Right = right
+			return nil
+		}
+		ipset.Intervals = append(ipset.Intervals, Interval{left, right, value})
+		return nil
+	}
+
 	ipset.Intervals = append(ipset.Intervals, Interval{left, right, value})
 	if len(ipset.Intervals) == 1 {
 		return nil
@@ -103,13 +121,19 @@ func (ipset *IntervalMap) add(left, right uint32, value interface{}) error {
 		}
 
 		if val.Left >= last.Left && val.Left <= last.Right {
+			if right-last.Left > maxIntervalSpan {
+				// too wide to merge, the rest becomes its own interval
+				last = Interval{last.Right + 1, right, last.Value}
+				newset = append(newset, last)
+				continue
+			}
 			last.Right = right
 			newset[len(newset)-1] = last
 			continue
 		}
 		// extend previous interval if the end of one is the start of another
 		// AND the values are the same
-		if val.Left == last.Right+1 && val.Value == last.Value {
+		if val.Left == last.Right+1 && val.Right-last.Left <= maxIntervalSpan && sameValue(val.Value, last.Value) {
 			last.Right = val.Right
 			newset[len(newset)-1] = last
 			continue
@@ -122,6 +146,37 @@ func (ipset *IntervalMap) add(left, right uint32, value interface{}) error {
 	return ipset.Valid()
 }
 
+// insert adds an arbitrarily large interval by feeding it to add in
+// pieces no bigger than add accepts.  Adjacent pieces share a value and
+// are coalesced back together, up to the size Valid allows.
+func (ipset *IntervalMap) insert(left, right uint32, value interface{}) error {
+	const chunk = uint32(1) << 24
+	for right-left >= chunk {
+		if err := ipset.add(left, left+chunk-1, value); err != nil {
+			return err
+		}
+		left += chunk
+	}
+	return ipset.add(left, right, value)
+}
+
+// sameValue compares two interval values.  Values that are not
+// comparable with == (maps, slices) are compared deeply instead of
+// panicking.
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ta, tb := reflect.TypeOf(a), reflect.TypeOf(b)
+	if ta != tb {
+		return false
+	}
+	if ta.Comparable() {
+		return a == b
+	}
+	return reflect.DeepEqual(a, b)
+}
+
 // Valid return error if internally invalid or nil if correct
 func (ipset IntervalMap) Valid() error {
 	last := Interval{}
@@ -130,7 +185,7 @@ func (ipset IntervalMap) Valid() error {
 			return fmt.Errorf("left %s > right %s at pos %d",
 				ToDots(val.Left), ToDots(val.Right), pos)
 		}
-		if val.Right-val.Left > (uint32(255) << 24) {
+		if val.Right-val.Left > maxIntervalSpan {
 			return fmt.Errorf("Interval too large: [%s,%s]",
 				ToDots(val.Left), ToDots(val.Right))
 		}
@@ -146,7 +201,9 @@ func (ipset IntervalMap) Valid() error {
 	return nil
 }
 
-// Add inserts a single IP or a range based with CIDR notation
+// Add inserts a single IP or a range based with CIDR notation.  Other
+// forms understood by ParseRangeSpec, such as "10.0.0.1-50" or
+// "192.168.*.1", are accepted as well.
 func (ipset *IntervalMap) Add(dots string, value interface{}) error {
 	var left, right uint32
 	var err error
@@ -154,14 +211,14 @@ func (ipset *IntervalMap) Add(dots string, value interface{}) error {
 	if strings.IndexByte(dots, '/') == -1 {
 		left, err = FromDots(dots)
 		if err != nil {
-			return fmt.Errorf("Unable to parse %q", dots)
+			return ipset.addSpec(dots, value)
 		}
 		right = left
 	} else {
 		// It's a CIDR
 		leftip, cidrnet, err := net.ParseCIDR(dots)
 		if err != nil {
-			return err
+			return ipset.addSpec(dots, value)
 		}
 		ones, _ := cidrnet.Mask.Size()
 		left, _ = FromNetIP(leftip)
@@ -171,6 +228,20 @@ func (ipset *IntervalMap) Add(dots string, value interface{}) error {
 	return ipset.add(left, right, value)
 }
 
+// addSpec inserts every range of a ParseRangeSpec spec
+func (ipset *IntervalMap) addSpec(spec string, value interface{}) error {
+	ranges, err := ParseRangeSpec(spec, RangeStrict)
+	if err != nil {
+		return err
+	}
+	for _, r := range ranges {
+		if err := ipset.add(r.Left, r.Right, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // AddRange adds a range of IP addresses
 func (ipset *IntervalMap) AddRange(dotsleft, dotsright string, value interface{}) error {
 	left, err := FromDots(dotsleft)
@@ -196,6 +267,11 @@ func (ipset IntervalMap) Contains(dots string) interface{} {
 	if err != nil {
 		return nil
 	}
+	return ipset.lookup(val)
+}
+
+// lookup returns the value of the interval containing val, or nil
+func (ipset IntervalMap) lookup(val uint32) interface{} {
 	ilen := ipset.Intervals.Len()
 	if ilen == 0 {
 		return nil
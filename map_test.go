@@ -170,6 +170,45 @@ func TestOverlaps2(t *testing.T) {
 	}
 }
 
+// Coalescing stops at the widest interval Valid allows, whichever path
+// the pieces take
+func TestInsertWholeSpace(t *testing.T) {
+	set := NewIntervalMap(10)
+	if err := set.insert(0, 0xFFFFFFFF, "all"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := set.Valid(); err != nil || set.Len() != 2 {
+		t.Errorf("Set state is invalid: %v\n%s", err, set)
+	}
+	if err := set.Add("10.0.0.0/8", "ten"); err != nil {
+		t.Errorf("Add after the whole space failed: %s", err)
+	}
+
+	// pieces arriving out of order
+	set = NewIntervalMap(10)
+	if err := set.insert(0xFF000000, 0xFFFFFFFF, "all"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := set.insert(0, 0xFEFFFFFF, "all"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := set.Valid(); err != nil {
+		t.Errorf("Set state is invalid: %s\n%s", err, set)
+	}
+
+	// an overlap that would extend past the limit
+	set = NewIntervalMap(10)
+	if err := set.insert(0, 0xFEFFFFFF, "all"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := set.insert(0xFEFFFF00, 0xFF0000FF, "all"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := set.Valid(); err != nil || set.Contains("255.0.0.255") != "all" {
+		t.Errorf("Set state is invalid: %v\n%s", err, set)
+	}
+}
+
 func TestEmpty(t *testing.T) {
 	set := NewIntervalMap(100)
 	err := set.Valid()
@@ -0,0 +1,128 @@
+package ipv4
+
+import (
+	"fmt"
+)
+
+// Mask zeroes the host bits of an address, keeping the first bits bits.
+// Mask(addr, 24) truncates to the /24 the way analytics IP anonymization
+// usually does.
+func Mask(addr uint32, bits byte) uint32 {
+	if bits >= 32 {
+		return addr
+	}
+	return addr &^ uint32(uint64(1)<<uint(32-bits)-1)
+}
+
+// MaskDots is Mask for dotted addresses
+func MaskDots(dots string, bits byte) (string, error) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return "", err
+	}
+	return ToDots(Mask(addr, bits)), nil
+}
+
+// AdaptiveMasker coarsens addresses only as much as needed for
+// k-anonymity: each address is masked to the longest prefix that
+// contains at least K distinct observed addresses.  Dense networks keep
+// more bits than sparse ones.  Observing an address again does not count,
+// so one busy client can not reach K on its own.
+//
+//	m := ipv4.NewAdaptiveMasker(10, 24)
+//	m.AddSet(seen)
+//	cidr := m.MaskCIDR(addr)
+type AdaptiveMasker struct {
+	// K is the minimum number of observed addresses per output prefix
+	K int
+
+	// MaxBits is the longest prefix returned
+	MaxBits byte
+
+	root maskNode
+}
+
+// maskNode counts the observed addresses under a prefix.  The trie goes
+// down to /32 whatever MaxBits is, so a non-zero /32 leaf marks an
+// address already observed.
+type maskNode struct {
+	count    int
+	children [2]*maskNode
+}
+
+// NewAdaptiveMasker creates an AdaptiveMasker that keeps at most maxBits
+// bits of each address
+func NewAdaptiveMasker(k int, maxBits byte) *AdaptiveMasker {
+	if maxBits > 32 {
+		maxBits = 32
+	}
+	return &AdaptiveMasker{K: k, MaxBits: maxBits}
+}
+
+// Observe adds an address to the population, addresses already observed
+// are ignored
+func (m *AdaptiveMasker) Observe(addr uint32) {
+	var path [33]*maskNode
+	path[0] = &m.root
+	for i := 0; i < 32; i++ {
+		n := path[i]
+		bit := addr >> (31 - uint(i)) & 1
+		if n.children[bit] == nil {
+			n.children[bit] = &maskNode{}
+		}
+		path[i+1] = n.children[bit]
+	}
+	if path[32].count != 0 {
+		return
+	}
+	for _, n := range path {
+		n.count++
+	}
+}
+
+// AddSet adds every address in a Set to the population
+func (m *AdaptiveMasker) AddSet(s Set) {
+	for _, addr := range s {
+		m.Observe(addr)
+	}
+}
+
+// Count returns the number of distinct observed addresses
+func (m *AdaptiveMasker) Count() int {
+	return m.root.count
+}
+
+// Bits returns the prefix length an address is masked to.  It is 0 when
+// fewer than K addresses have been observed in total.
+func (m *AdaptiveMasker) Bits(addr uint32) byte {
+	n := &m.root
+	bits := byte(0)
+	for i := byte(0); i < m.MaxBits; i++ {
+		n = n.children[addr>>(31-i)&1]
+		if n == nil || n.count < m.K {
+			break
+		}
+		bits = i + 1
+	}
+	return bits
+}
+
+// Mask returns the address with its host bits zeroed
+func (m *AdaptiveMasker) Mask(addr uint32) uint32 {
+	return Mask(addr, m.Bits(addr))
+}
+
+// MaskCIDR returns the prefix an address is masked to, as a CIDR
+func (m *AdaptiveMasker) MaskCIDR(addr uint32) string {
+	bits := m.Bits(addr)
+	return fmt.Sprintf("%s/%d", ToDots(Mask(addr, bits)), bits)
+}
+
+// MaskDots is MaskCIDR for dotted addresses
+func (m *AdaptiveMasker) MaskDots(dots string) (string, error) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return "", err
+	}
+	return m.MaskCIDR(addr), nil
+}
@@ -0,0 +1,123 @@
+package ipv4
+
+import (
+	"testing"
+)
+
+func TestMask(t *testing.T) {
+	cases := []struct {
+		dots string
+		bits byte
+		want string
+	}{
+		{"192.168.10.200", 24, "192.168.10.0"},
+		{"192.168.10.200", 16, "192.168.0.0"},
+		{"192.168.10.200", 32, "192.168.10.200"},
+		{"192.168.10.200", 40, "192.168.10.200"},
+		{"192.168.10.200", 0, "0.0.0.0"},
+		{"255.255.255.255", 1, "128.0.0.0"},
+	}
+	for _, c := range cases {
+		got, err := MaskDots(c.dots, c.bits)
+		if err != nil || got != c.want {
+			t.Errorf("MaskDots(%s, %d) = %s, %v, want %s", c.dots, c.bits, got, err, c.want)
+		}
+	}
+	if _, err := MaskDots("junk", 24); err == nil {
+		t.Errorf("Expected error on bad address")
+	}
+}
+
+func TestAdaptiveMasker(t *testing.T) {
+	seen := NewSet(0)
+	// a dense /24 with 20 hosts, 10 of them in the first /28
+	for i := 1; i <= 10; i++ {
+		seen.Add(ToDots(0x0A000000 + uint32(i)))
+		seen.Add(ToDots(0x0A000000 + uint32(100+i)))
+	}
+	// a few scattered hosts elsewhere in 10.0.0.0/16
+	seen.Add("10.0.5.1")
+	seen.Add("10.0.9.1")
+	// a lone host elsewhere
+	seen.Add("172.16.0.1")
+
+	m := NewAdaptiveMasker(5, 24)
+	m.AddSet(seen)
+	if m.Count() != 23 {
+		t.Fatalf("Count = %d, want 23", m.Count())
+	}
+
+	cases := []struct {
+		dots string
+		want string
+	}{
+		{"10.0.0.3", "10.0.0.0/24"},   // capped at MaxBits
+		{"10.0.5.1", "10.0.0.0/21"},   // 21 addresses in 10.0.0.0/21, 1 in 10.0.4.0/22
+		{"10.0.200.1", "10.0.0.0/16"}, // unobserved, but its /16 is populated
+		{"172.16.0.1", "0.0.0.0/0"},   // the /1 with it has one host
+		{"junk", ""},
+	}
+	for _, c := range cases {
+		got, err := m.MaskDots(c.dots)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("Expected error on %q", c.dots)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("MaskDots(%s) = %s, %v, want %s", c.dots, got, err, c.want)
+		}
+	}
+
+	// every output prefix has at least K observed addresses
+	for _, addr := range seen {
+		bits := m.Bits(addr)
+		prefix := Mask(addr, bits)
+		n := 0
+		for _, other := range seen {
+			if Mask(other, bits) == prefix {
+				n++
+			}
+		}
+		if n < m.K {
+			t.Errorf("%s masks to %s which has %d addresses", ToDots(addr), m.MaskCIDR(addr), n)
+		}
+		if m.Mask(addr) != prefix {
+			t.Errorf("Mask(%s) = %s, want %s", ToDots(addr), ToDots(m.Mask(addr)), ToDots(prefix))
+		}
+	}
+
+	full := NewAdaptiveMasker(1, 40)
+	full.Observe(0x01020304)
+	if got := full.MaskCIDR(0x01020304); got != "1.2.3.4/32" {
+		t.Errorf("MaskCIDR with K=1 = %s, want 1.2.3.4/32", got)
+	}
+	empty := NewAdaptiveMasker(1, 32)
+	if got := empty.MaskCIDR(0x01020304); got != "0.0.0.0/0" {
+		t.Errorf("MaskCIDR on empty masker = %s, want 0.0.0.0/0", got)
+	}
+}
+
+func TestAdaptiveMaskerRepeats(t *testing.T) {
+	m := NewAdaptiveMasker(5, 32)
+	for i := 0; i < 5; i++ {
+		m.Observe(0x0A000001)
+	}
+	m.Observe(0x0A000102)
+	if m.Count() != 2 {
+		t.Errorf("Count = %d, want 2", m.Count())
+	}
+	if got := m.MaskCIDR(0x0A000001); got != "0.0.0.0/0" {
+		t.Errorf("MaskCIDR after repeats = %s, want 0.0.0.0/0", got)
+	}
+
+	// distinct addresses in the same /24 still count with MaxBits 24
+	m = NewAdaptiveMasker(3, 24)
+	for _, addr := range []uint32{0x0A000001, 0x0A000001, 0x0A000002, 0x0A000003} {
+		m.Observe(addr)
+	}
+	if got := m.MaskCIDR(0x0A000001); got != "10.0.0.0/24" {
+		t.Errorf("MaskCIDR = %s, want 10.0.0.0/24", got)
+	}
+}
@@ -0,0 +1,504 @@
+package ipv4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrBadMMDB is returned when a MaxMind DB file can not be decoded
+var ErrBadMMDB = errors.New("Bad MaxMind DB file")
+
+// mmdbMetadataMarker starts the metadata section at the end of the file
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// MMDB data section types
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// MMDBMetadata is the metadata section of a MaxMind DB file
+type MMDBMetadata struct {
+	NodeCount                uint
+	RecordSize               uint
+	IPVersion                uint
+	DatabaseType             string
+	Languages                []string
+	BinaryFormatMajorVersion uint
+	BinaryFormatMinorVersion uint
+	BuildEpoch               uint64
+	Description              map[string]string
+}
+
+// MMDB is a MaxMind DB (.mmdb) file held in memory, such as
+// GeoLite2-Country or GeoLite2-ASN.  Only the IPv4 part of the search
+// tree is used.
+//
+// See https://maxmind.github.io/MaxMind-DB/
+type MMDB struct {
+	Metadata MMDBMetadata
+
+	tree      []byte
+	data      []byte
+	ipv4Start uint
+}
+
+// OpenMMDB reads a .mmdb file into memory
+func OpenMMDB(filename string) (*MMDB, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewMMDB(buf)
+}
+
+// NewMMDB decodes a MaxMind DB file from a byte slice.  The slice is
+// used directly and must not be modified afterwards.
+func NewMMDB(buf []byte) (*MMDB, error) {
+	pos := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if pos == -1 {
+		return nil, fmt.Errorf("%v: metadata marker not found", ErrBadMMDB)
+	}
+	metabuf := buf[pos+len(mmdbMetadataMarker):]
+	raw, _, err := mmdbDecoder{buf: metabuf}.decode(0)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := mmdbParseMetadata(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	switch meta.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%v: unsupported record size %d", ErrBadMMDB, meta.RecordSize)
+	}
+	if meta.IPVersion != 4 && meta.IPVersion != 6 {
+		return nil, fmt.Errorf("%v: unsupported ip_version %d", ErrBadMMDB, meta.IPVersion)
+	}
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	if treeSize+16 > uint(pos) {
+		return nil, fmt.Errorf("%v: search tree larger than file", ErrBadMMDB)
+	}
+
+	db := &MMDB{
+		Metadata: meta,
+		tree:     buf[:treeSize],
+		data:     buf[treeSize+16 : pos],
+	}
+
+	// IPv4 addresses live at ::/96 in an IPv6 tree
+	if meta.IPVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func mmdbParseMetadata(raw interface{}) (MMDBMetadata, error) {
+	meta := MMDBMetadata{}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return meta, fmt.Errorf("%v: metadata is not a map", ErrBadMMDB)
+	}
+	getUint := func(key string) uint64 {
+		v, _ := m[key].(uint64)
+		return v
+	}
+	meta.NodeCount = uint(getUint("node_count"))
+	meta.RecordSize = uint(getUint("record_size"))
+	meta.IPVersion = uint(getUint("ip_version"))
+	meta.BinaryFormatMajorVersion = uint(getUint("binary_format_major_version"))
+	meta.BinaryFormatMinorVersion = uint(getUint("binary_format_minor_version"))
+	meta.BuildEpoch = getUint("build_epoch")
+	meta.DatabaseType, _ = m["database_type"].(string)
+	if langs, ok := m["languages"].([]interface{}); ok {
+		for _, l := range langs {
+			if s, ok := l.(string); ok {
+				meta.Languages = append(meta.Languages, s)
+			}
+		}
+	}
+	if desc, ok := m["description"].(map[string]interface{}); ok {
+		meta.Description = make(map[string]string, len(desc))
+		for k, v := range desc {
+			if s, ok := v.(string); ok {
+				meta.Description[k] = s
+			}
+		}
+	}
+	if meta.NodeCount == 0 || meta.RecordSize == 0 || meta.IPVersion == 0 {
+		return meta, fmt.Errorf("%v: missing required metadata", ErrBadMMDB)
+	}
+	return meta, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (db *MMDB) record(node uint, bit uint32) uint {
+	switch db.Metadata.RecordSize {
+	case 24:
+		off := node*6 + uint(bit)*3
+		b := db.tree[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := db.tree[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + uint(bit)*4
+		return uint(binary.BigEndian.Uint32(db.tree[off : off+4]))
+	}
+}
+
+// resolve converts a record pointing into the data section to a data
+// section offset
+func (db *MMDB) resolve(record uint) (int, error) {
+	off := record - db.Metadata.NodeCount - 16
+	if record < db.Metadata.NodeCount+16 || off >= uint(len(db.data)) {
+		return 0, fmt.Errorf("%v: invalid data pointer %d", ErrBadMMDB, record)
+	}
+	return int(off), nil
+}
+
+// lookup walks the tree, returning the data record (or 0 if not found)
+// and the prefix length of the matching network
+func (db *MMDB) lookup(addr uint32) (uint, byte, error) {
+	node := db.ipv4Start
+	count := db.Metadata.NodeCount
+	var depth byte
+	for ; depth < 32 && node < count; depth++ {
+		node = db.record(node, (addr>>(31-depth))&1)
+	}
+	switch {
+	case node == count:
+		return 0, depth, nil
+	case node > count:
+		return node, depth, nil
+	}
+	return 0, 0, fmt.Errorf("%v: search tree deeper than 32 bits", ErrBadMMDB)
+}
+
+// Lookup returns the decoded record for an address, or nil if the
+// address is not in the database.  Maps decode to map[string]interface{},
+// arrays to []interface{} and all unsigned integers to uint64.
+func (db *MMDB) Lookup(addr uint32) (interface{}, error) {
+	val, _, err := db.LookupNetwork(addr)
+	return val, err
+}
+
+// LookupNetwork is like Lookup but also returns the prefix length of the
+// network in the database that contains the address.
+func (db *MMDB) LookupNetwork(addr uint32) (interface{}, byte, error) {
+	record, bits, err := db.lookup(addr)
+	if err != nil || record == 0 {
+		return nil, bits, err
+	}
+	off, err := db.resolve(record)
+	if err != nil {
+		return nil, 0, err
+	}
+	val, _, err := mmdbDecoder{buf: db.data}.decode(off)
+	return val, bits, err
+}
+
+// LookupField returns a single field of the record for a dotted IPv4
+// address.  See MMDBField for the path syntax.
+func (db *MMDB) LookupField(dots string, path string) (interface{}, error) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return nil, err
+	}
+	val, err := db.Lookup(addr)
+	if err != nil || val == nil {
+		return nil, err
+	}
+	val, _ = MMDBField(val, path)
+	return val, nil
+}
+
+// MMDBField extracts a value from a decoded record using a dotted path,
+// such as "country.iso_code" or "subdivisions.0.names.en".  Numeric path
+// elements index arrays.  An empty path returns the whole record.
+func MMDBField(record interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return record, record != nil
+	}
+	val := record
+	for _, key := range strings.Split(path, ".") {
+		switch v := val.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			val = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			val = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// IntervalMap exports the IPv4 part of the database into an IntervalMap.
+// Each interval's value is the field selected by path (see MMDBField).
+// Networks without that field are skipped, and adjacent networks with
+// equal values are coalesced.
+func (db *MMDB) IntervalMap(path string) (*IntervalMap, error) {
+	out := NewIntervalMap(1024)
+	cache := make(map[uint]interface{})
+	var walk func(node uint, addr uint32, depth uint) error
+	walk = func(node uint, addr uint32, depth uint) error {
+		count := db.Metadata.NodeCount
+		switch {
+		case node == count:
+			return nil
+		case node > count:
+			val, ok := cache[node]
+			if !ok {
+				off, err := db.resolve(node)
+				if err != nil {
+					return err
+				}
+				record, _, err := mmdbDecoder{buf: db.data}.decode(off)
+				if err != nil {
+					return err
+				}
+				val, _ = MMDBField(record, path)
+				cache[node] = val
+			}
+			if val == nil {
+				return nil
+			}
+			last := addr | uint32(uint64(1)<<(32-depth)-1)
+			return out.insert(addr, last, val)
+		case depth == 32:
+			return fmt.Errorf("%v: search tree deeper than 32 bits", ErrBadMMDB)
+		}
+		if err := walk(db.record(node, 0), addr, depth+1); err != nil {
+			return err
+		}
+		return walk(db.record(node, 1), addr|uint32(1)<<(31-depth), depth+1)
+	}
+	if err := walk(db.ipv4Start, 0, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// mmdbDecoder decodes values from a data section (or the metadata)
+type mmdbDecoder struct {
+	buf   []byte
+	depth int // pointers, maps and arrays followed to get here
+}
+
+// mmdbMaxDepth limits the nesting decoded, as libmaxminddb does, so that
+// a pointer cycle is an error rather than a stack overflow
+const mmdbMaxDepth = 512
+
+func (d mmdbDecoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%v: %s", ErrBadMMDB, fmt.Sprintf(format, args...))
+}
+
+// decodeControl reads a control byte (and any extended type or size
+// bytes) returning the type, size and offset of the payload
+func (d mmdbDecoder) decodeControl(off int) (int, int, int, error) {
+	if off >= len(d.buf) {
+		return 0, 0, 0, d.errorf("unexpected end of data at %d", off)
+	}
+	ctrl := d.buf[off]
+	off++
+	kind := int(ctrl >> 5)
+	if kind == mmdbPointer {
+		return kind, int(ctrl & 0x1F), off, nil
+	}
+	if kind == mmdbExtended {
+		if off >= len(d.buf) {
+			return 0, 0, 0, d.errorf("unexpected end of data at %d", off)
+		}
+		kind = 7 + int(d.buf[off])
+		off++
+		if kind <= mmdbMap || kind > mmdbFloat {
+			return 0, 0, 0, d.errorf("invalid extended type %d", kind)
+		}
+	}
+	size := int(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if off+n > len(d.buf) {
+			return 0, 0, 0, d.errorf("unexpected end of data at %d", off)
+		}
+		ext := 0
+		for _, b := range d.buf[off : off+n] {
+			ext = ext<<8 | int(b)
+		}
+		off += n
+		switch size {
+		case 29:
+			size = 29 + ext
+		case 30:
+			size = 285 + ext
+		default:
+			size = 65821 + ext
+		}
+	}
+	return kind, size, off, nil
+}
+
+// decode returns the value at off and the offset following it
+func (d mmdbDecoder) decode(off int) (interface{}, int, error) {
+	if d.depth > mmdbMaxDepth {
+		return nil, 0, d.errorf("data nested more than %d deep at %d", mmdbMaxDepth, off)
+	}
+	kind, size, off, err := d.decodeControl(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	inner := mmdbDecoder{buf: d.buf, depth: d.depth + 1}
+	if kind == mmdbPointer {
+		n := size>>3&0x3 + 1
+		if off+n > len(d.buf) {
+			return nil, 0, d.errorf("unexpected end of data at %d", off)
+		}
+		ptr := 0
+		if n < 4 {
+			ptr = size & 0x7
+		}
+		for _, b := range d.buf[off : off+n] {
+			ptr = ptr<<8 | int(b)
+		}
+		switch n {
+		case 2:
+			ptr += 2048
+		case 3:
+			ptr += 526336
+		}
+		// pointers to pointers are not allowed by the spec
+		if ptr < len(d.buf) && d.buf[ptr]>>5 == mmdbPointer {
+			return nil, 0, d.errorf("pointer to pointer at %d", off)
+		}
+		val, _, err := inner.decode(ptr)
+		return val, off + n, err
+	}
+
+	// every element takes at least a byte, so a larger size is corrupt
+	// and would only make us allocate for data that isn't there
+	if (kind == mmdbMap || kind == mmdbArray) && size > len(d.buf)-off {
+		return nil, 0, d.errorf("%d elements with %d bytes left at %d", size, len(d.buf)-off, off)
+	}
+	switch kind {
+	case mmdbMap:
+		m := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			var key, val interface{}
+			key, off, err = inner.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			skey, ok := key.(string)
+			if !ok {
+				return nil, 0, d.errorf("map key is not a string at %d", off)
+			}
+			val, off, err = inner.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[skey] = val
+		}
+		return m, off, nil
+	case mmdbArray:
+		a := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			var val interface{}
+			val, off, err = inner.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, val)
+		}
+		return a, off, nil
+	case mmdbBool:
+		return size != 0, off, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, 0, d.errorf("unsupported type %d at %d", kind, off)
+	}
+
+	if off+size > len(d.buf) {
+		return nil, 0, d.errorf("unexpected end of data at %d", off)
+	}
+	payload := d.buf[off : off+size]
+	off += size
+	switch kind {
+	case mmdbString:
+		return string(payload), off, nil
+	case mmdbBytes:
+		return append([]byte(nil), payload...), off, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, d.errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), off, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, d.errorf("invalid float size %d", size)
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(payload)), off, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		if size > 8 || (kind == mmdbUint16 && size > 2) || (kind == mmdbUint32 && size > 4) {
+			return nil, 0, d.errorf("invalid unsigned integer size %d", size)
+		}
+		var v uint64
+		for _, b := range payload {
+			v = v<<8 | uint64(b)
+		}
+		return v, off, nil
+	case mmdbInt32:
+		if size > 4 {
+			return nil, 0, d.errorf("invalid int32 size %d", size)
+		}
+		var v uint32
+		for _, b := range payload {
+			v = v<<8 | uint32(b)
+		}
+		return int(int32(v)), off, nil
+	case mmdbUint128:
+		if size > 16 {
+			return nil, 0, d.errorf("invalid uint128 size %d", size)
+		}
+		return new(big.Int).SetBytes(payload), off, nil
+	}
+	return nil, 0, d.errorf("unknown type %d", kind)
+}
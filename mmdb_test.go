@@ -0,0 +1,335 @@
+package ipv4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testMMDBNetwork is a network and record for building test databases
+type testMMDBNetwork struct {
+	cidr   string
+	record map[string]interface{}
+}
+
+// encodeTestMMDB is a minimal encoder used to build .mmdb fixtures.
+// It supports maps, arrays, strings and unsigned integers.
+func encodeTestMMDB(buf *bytes.Buffer, val interface{}) {
+	ctrl := func(kind int, size int) {
+		if kind > 7 {
+			buf.WriteByte(byte(size))
+			buf.WriteByte(byte(kind - 7))
+			return
+		}
+		buf.WriteByte(byte(kind<<5 | size))
+	}
+	switch v := val.(type) {
+	case string:
+		ctrl(mmdbString, len(v))
+		buf.WriteString(v)
+	case uint64:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], v)
+		n := 0
+		for n < 8 && b[n] == 0 {
+			n++
+		}
+		ctrl(mmdbUint64, 8-n)
+		buf.Write(b[n:])
+	case []interface{}:
+		ctrl(mmdbArray, len(v))
+		for _, x := range v {
+			encodeTestMMDB(buf, x)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		ctrl(mmdbMap, len(v))
+		for _, k := range keys {
+			encodeTestMMDB(buf, k)
+			encodeTestMMDB(buf, v[k])
+		}
+	default:
+		panic("unsupported test type")
+	}
+}
+
+// buildTestMMDB creates an IPv6 database (IPv4 at ::/96) with 24-bit
+// records, which is the layout of the GeoLite2 databases
+func buildTestMMDB(t *testing.T, networks []testMMDBNetwork) []byte {
+	type node struct {
+		child [2]*node
+		data  [2]int
+	}
+	newNode := func() *node { return &node{data: [2]int{-1, -1}} }
+	root := newNode()
+
+	data := bytes.Buffer{}
+	for _, n := range networks {
+		left, right, err := CIDR2Range(n.cidr)
+		if err != nil {
+			t.Fatalf("bad fixture cidr %q: %s", n.cidr, err)
+		}
+		l, _ := FromDots(left)
+		r, _ := FromDots(right)
+		bits := 32
+		for size := r - l; size != 0; size >>= 1 {
+			bits--
+		}
+		off := data.Len()
+		encodeTestMMDB(&data, n.record)
+
+		cur := root
+		for depth := 0; depth < 96+bits-1; depth++ {
+			bit := 0
+			if depth >= 96 {
+				bit = int(l >> uint(127-depth) & 1)
+			}
+			if cur.child[bit] == nil {
+				cur.child[bit] = newNode()
+			}
+			cur = cur.child[bit]
+		}
+		cur.data[l>>uint(32-bits)&1] = off
+	}
+
+	// number nodes breadth first
+	var order []*node
+	index := map[*node]int{}
+	queue := []*node{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		index[n] = len(order)
+		order = append(order, n)
+		for _, c := range n.child {
+			if c != nil {
+				queue = append(queue, c)
+			}
+		}
+	}
+	count := len(order)
+	out := bytes.Buffer{}
+	for _, n := range order {
+		for i := 0; i < 2; i++ {
+			rec := count
+			if n.child[i] != nil {
+				rec = index[n.child[i]]
+			} else if n.data[i] >= 0 {
+				rec = count + 16 + n.data[i]
+			}
+			out.Write([]byte{byte(rec >> 16), byte(rec >> 8), byte(rec)})
+		}
+	}
+	out.Write(make([]byte, 16))
+	out.Write(data.Bytes())
+	out.Write(mmdbMetadataMarker)
+	encodeTestMMDB(&out, map[string]interface{}{
+		"node_count":                  uint64(count),
+		"record_size":                 uint64(24),
+		"ip_version":                  uint64(6),
+		"database_type":               "Test-Country",
+		"languages":                   []interface{}{"en"},
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"build_epoch":                 uint64(1600000000),
+		"description":                 map[string]interface{}{"en": "test"},
+	})
+	return out.Bytes()
+}
+
+func testCountry(iso string) map[string]interface{} {
+	return map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": iso,
+			"names":    map[string]interface{}{"en": iso + " land"},
+		},
+		"asn": uint64(len(iso)),
+	}
+}
+
+var testMMDBNetworks = []testMMDBNetwork{
+	{"1.0.0.0/24", testCountry("AU")},
+	{"1.0.1.0/24", testCountry("CN")},
+	{"1.0.2.0/23", testCountry("CN")},
+	{"8.8.8.0/24", testCountry("US")},
+	{"10.0.0.0/8", map[string]interface{}{"private": uint64(1)}},
+	{"200.0.0.0/7", testCountry("BR")},
+}
+
+func TestMMDBLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fname := filepath.Join(dir, "test.mmdb")
+	if err := ioutil.WriteFile(fname, buildTestMMDB(t, testMMDBNetworks), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := OpenMMDB(fname)
+	if err != nil {
+		t.Fatalf("OpenMMDB failed: %s", err)
+	}
+	if db.Metadata.DatabaseType != "Test-Country" || db.Metadata.IPVersion != 6 ||
+		db.Metadata.Description["en"] != "test" || len(db.Metadata.Languages) != 1 {
+		t.Errorf("Bad metadata: %+v", db.Metadata)
+	}
+
+	tests := []struct {
+		dots string
+		path string
+		want interface{}
+	}{
+		{"1.0.0.0", "country.iso_code", "AU"},
+		{"1.0.0.255", "country.names.en", "AU land"},
+		{"1.0.3.7", "country.iso_code", "CN"},
+		{"1.0.4.0", "country.iso_code", nil},
+		{"8.8.8.8", "asn", uint64(2)},
+		{"8.8.8.8", "country.missing", nil},
+		{"10.1.2.3", "private", uint64(1)},
+		{"10.1.2.3", "country.iso_code", nil},
+		{"201.255.255.255", "country.iso_code", "BR"},
+		{"255.255.255.255", "country.iso_code", nil},
+	}
+	for _, tt := range tests {
+		got, err := db.LookupField(tt.dots, tt.path)
+		if err != nil {
+			t.Errorf("LookupField(%q, %q) error: %s", tt.dots, tt.path, err)
+		}
+		if got != tt.want {
+			t.Errorf("LookupField(%q, %q) = %v, want %v", tt.dots, tt.path, got, tt.want)
+		}
+	}
+
+	_, bits, err := db.LookupNetwork(0x01000300)
+	if err != nil || bits != 23 {
+		t.Errorf("LookupNetwork(1.0.3.0) = /%d, %v, want /23", bits, err)
+	}
+}
+
+func TestMMDBIntervalMap(t *testing.T) {
+	db, err := NewMMDB(buildTestMMDB(t, testMMDBNetworks))
+	if err != nil {
+		t.Fatalf("NewMMDB failed: %s", err)
+	}
+	m, err := db.IntervalMap("country.iso_code")
+	if err != nil {
+		t.Fatalf("IntervalMap failed: %s", err)
+	}
+	if err := m.Valid(); err != nil {
+		t.Fatalf("IntervalMap is invalid: %s", err)
+	}
+	// the two CN networks coalesce, 10/8 has no country
+	want := []string{
+		"[1.0.0.0, 1.0.0.255]=AU",
+		"[1.0.1.0, 1.0.3.255]=CN",
+		"[8.8.8.0, 8.8.8.255]=US",
+		"[200.0.0.0, 201.255.255.255]=BR",
+	}
+	if m.Len() != len(want) {
+		t.Fatalf("Got %d intervals, want %d:\n%s", m.Len(), len(want), m)
+	}
+	for i, w := range want {
+		if got := m.Intervals[i].String(); got != w {
+			t.Errorf("Interval %d = %s, want %s", i, got, w)
+		}
+	}
+
+	// whole records are maps, equal maps still coalesce
+	m, err = db.IntervalMap("")
+	if err != nil {
+		t.Fatalf("IntervalMap failed: %s", err)
+	}
+	if m.Len() != 5 {
+		t.Errorf("Got %d intervals, want 5:\n%s", m.Len(), m)
+	}
+}
+
+func TestMMDBErrors(t *testing.T) {
+	if _, err := NewMMDB([]byte("junk")); err == nil {
+		t.Errorf("Expected error on missing metadata")
+	}
+	good := buildTestMMDB(t, testMMDBNetworks)
+	// chop the tree so it no longer fits
+	pos := bytes.LastIndex(good, mmdbMetadataMarker)
+	if _, err := NewMMDB(good[pos-20:]); err == nil {
+		t.Errorf("Expected error on truncated tree")
+	}
+	if _, err := OpenMMDB("/does/not/exist.mmdb"); err == nil {
+		t.Errorf("Expected error on missing file")
+	}
+}
+
+func TestMMDBField(t *testing.T) {
+	rec := map[string]interface{}{
+		"subdivisions": []interface{}{
+			map[string]interface{}{"iso_code": "CA"},
+		},
+	}
+	tests := []struct {
+		path string
+		want interface{}
+		ok   bool
+	}{
+		{"subdivisions.0.iso_code", "CA", true},
+		{"subdivisions.1.iso_code", nil, false},
+		{"subdivisions.x", nil, false},
+		{"subdivisions.0.iso_code.more", nil, false},
+		{"missing", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := MMDBField(rec, tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("MMDBField(%q) = %v, %t, want %v, %t", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestMMDBPointerCycle(t *testing.T) {
+	// {"a": pointer to offset 0}, a map containing itself
+	data := []byte{0xE1, 0x41, 'a', 0x20, 0x00}
+	if _, _, err := (mmdbDecoder{buf: data}).decode(0); err == nil {
+		t.Errorf("expected error for a pointer cycle")
+	}
+
+	// deep but finite nesting is fine
+	var nested []byte
+	for i := 0; i < 100; i++ {
+		nested = append(nested, 0x01, 0x04) // extended type 11, array of one element
+	}
+	nested = append(nested, 0x41, 'x')
+	val, _, err := (mmdbDecoder{buf: nested}).decode(0)
+	if err != nil {
+		t.Fatalf("decoding 100 nested arrays failed: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		a, ok := val.([]interface{})
+		if !ok || len(a) != 1 {
+			t.Fatalf("unexpected value at depth %d: %v", i, val)
+		}
+		val = a[0]
+	}
+	if val != "x" {
+		t.Errorf("innermost value = %v", val)
+	}
+}
+
+func TestMMDBHugeContainer(t *testing.T) {
+	// an array and a map claiming about 16.8M elements with no data
+	for _, data := range [][]byte{{0x1F, 0x04, 0xFF, 0xFF, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}} {
+		_, _, err := (mmdbDecoder{buf: data}).decode(0)
+		if err == nil || !strings.Contains(err.Error(), "elements") {
+			t.Errorf("% x: expected size error, got %v", data, err)
+		}
+	}
+}
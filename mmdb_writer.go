@@ -0,0 +1,351 @@
+package ipv4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// MMDBWriter writes an IntervalMap as a MaxMind DB (.mmdb) file.
+//
+// Interval values become the data records, see Write for the supported
+// types.
+type MMDBWriter struct {
+	DatabaseType string
+	Description  map[string]string
+	Languages    []string
+
+	// RecordSize is 24, 28 or 32 bits, or 0 to pick the smallest that fits
+	RecordSize uint
+
+	// IPVersion is 4 for an IPv4-only tree, or 6 to place the IPv4
+	// networks at ::/96 like the GeoLite2 databases.  0 means 4.
+	IPVersion uint
+
+	// BuildEpoch is the build time in seconds, or 0 for now
+	BuildEpoch uint64
+}
+
+// mmdbWriterNode is a search tree node under construction.  A child of
+// 0 means none since the root can never be a child.
+type mmdbWriterNode struct {
+	child [2]int
+	data  [2]int
+}
+
+// Write encodes the interval map to out.  The format has fewer types
+// than Go, so values do not always read back as the type written:
+//
+//	written                          read by MMDB
+//	string, []byte, bool             unchanged
+//	float64, float32                 unchanged
+//	uint8, uint16, uint32, uint      uint64
+//	uint64                           uint64
+//	int, int32, int64                int, or uint64 above MaxInt32
+//	[]interface{}, []string          []interface{}
+//	map[string]interface{},          map[string]interface{}
+//	map[string]string
+//
+// Signed integers below MinInt32 and other types are an error.
+func (mw MMDBWriter) Write(out io.Writer, m *IntervalMap) error {
+	ipVersion := mw.IPVersion
+	if ipVersion == 0 {
+		ipVersion = 4
+	}
+	if ipVersion != 4 && ipVersion != 6 {
+		return fmt.Errorf("unsupported ip_version %d", ipVersion)
+	}
+	depth := 32
+	if ipVersion == 6 {
+		depth = 128
+	}
+
+	// data section, identical records are stored once
+	data := mmdbEncoder{}
+	offsets := make(map[string]int)
+
+	nodes := []mmdbWriterNode{{data: [2]int{-1, -1}}}
+	insert := func(left uint32, mask byte, off int) {
+		cur := 0
+		plen := depth - 32 + int(mask)
+		for i := 0; i < plen-1; i++ {
+			bit := 0
+			if i >= depth-32 {
+				bit = int(left >> uint(31-(i-depth+32)) & 1)
+			}
+			next := nodes[cur].child[bit]
+			if next == 0 {
+				nodes = append(nodes, mmdbWriterNode{data: [2]int{-1, -1}})
+				next = len(nodes) - 1
+				nodes[cur].child[bit] = next
+			}
+			cur = next
+		}
+		nodes[cur].data[left>>uint(32-int(mask))&1] = off
+	}
+
+	for _, val := range m.Intervals {
+		rec := mmdbEncoder{}
+		if err := rec.encode(val.Value); err != nil {
+			return fmt.Errorf("interval %s: %v", val, err)
+		}
+		key := rec.buf.String()
+		off, ok := offsets[key]
+		if !ok {
+			off = data.buf.Len()
+			offsets[key] = off
+			data.buf.Write(rec.buf.Bytes())
+		}
+		Interval2CIDRs(val.Left, val.Right, func(left uint32, mask byte) {
+			if mask == 0 && ipVersion == 4 {
+				// the root has no parent record to hold a /0
+				insert(0, 1, off)
+				insert(0x80000000, 1, off)
+				return
+			}
+			insert(left, mask, off)
+		})
+	}
+
+	count := len(nodes)
+	maxRecord := uint64(count) + 16 + uint64(data.buf.Len())
+	recordSize := mw.RecordSize
+	if recordSize == 0 {
+		recordSize = 24
+		for maxRecord >= uint64(1)<<recordSize {
+			recordSize += 4
+		}
+	}
+	switch recordSize {
+	case 24, 28, 32:
+	default:
+		return fmt.Errorf("unsupported record size %d", recordSize)
+	}
+	if maxRecord >= uint64(1)<<recordSize {
+		return fmt.Errorf("database too large for %d bit records", recordSize)
+	}
+
+	tree := make([]byte, 0, count*int(recordSize)/4)
+	for _, n := range nodes {
+		var recs [2]uint32
+		for i := range recs {
+			switch {
+			case n.child[i] != 0:
+				recs[i] = uint32(n.child[i])
+			case n.data[i] >= 0:
+				recs[i] = uint32(count + 16 + n.data[i])
+			default:
+				recs[i] = uint32(count)
+			}
+		}
+		switch recordSize {
+		case 24:
+			tree = append(tree,
+				byte(recs[0]>>16), byte(recs[0]>>8), byte(recs[0]),
+				byte(recs[1]>>16), byte(recs[1]>>8), byte(recs[1]))
+		case 28:
+			tree = append(tree,
+				byte(recs[0]>>16), byte(recs[0]>>8), byte(recs[0]),
+				byte(recs[0]>>24)<<4|byte(recs[1]>>24),
+				byte(recs[1]>>16), byte(recs[1]>>8), byte(recs[1]))
+		default:
+			tree = append(tree,
+				byte(recs[0]>>24), byte(recs[0]>>16), byte(recs[0]>>8), byte(recs[0]),
+				byte(recs[1]>>24), byte(recs[1]>>16), byte(recs[1]>>8), byte(recs[1]))
+		}
+	}
+
+	epoch := mw.BuildEpoch
+	if epoch == 0 {
+		epoch = uint64(time.Now().Unix())
+	}
+	languages := make([]interface{}, len(mw.Languages))
+	for i, l := range mw.Languages {
+		languages[i] = l
+	}
+	description := make(map[string]interface{}, len(mw.Description))
+	for k, v := range mw.Description {
+		description[k] = v
+	}
+	meta := mmdbEncoder{}
+	err := meta.encode(map[string]interface{}{
+		"node_count":                  uint32(count),
+		"record_size":                 uint16(recordSize),
+		"ip_version":                  uint16(ipVersion),
+		"database_type":               mw.DatabaseType,
+		"languages":                   languages,
+		"description":                 description,
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"build_epoch":                 epoch,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, section := range [][]byte{
+		tree,
+		make([]byte, 16),
+		data.buf.Bytes(),
+		mmdbMetadataMarker,
+		meta.buf.Bytes(),
+	} {
+		if _, err := out.Write(section); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mmdbEncoder encodes values in the MaxMind DB data section format
+type mmdbEncoder struct {
+	buf bytes.Buffer
+}
+
+func (e *mmdbEncoder) control(kind int, size int) {
+	var ctrl [5]byte
+	n := 1
+	if kind > 7 {
+		ctrl[1] = byte(kind - 7)
+		n++
+	} else {
+		ctrl[0] = byte(kind << 5)
+	}
+	switch {
+	case size < 29:
+		ctrl[0] |= byte(size)
+	case size < 285:
+		ctrl[0] |= 29
+		ctrl[n] = byte(size - 29)
+		n++
+	case size < 65821:
+		ctrl[0] |= 30
+		size -= 285
+		ctrl[n], ctrl[n+1] = byte(size>>8), byte(size)
+		n += 2
+	default:
+		ctrl[0] |= 31
+		size -= 65821
+		ctrl[n], ctrl[n+1], ctrl[n+2] = byte(size>>16), byte(size>>8), byte(size)
+		n += 3
+	}
+	e.buf.Write(ctrl[:n])
+}
+
+func (e *mmdbEncoder) uint(kind int, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	n := 0
+	for n < 8 && b[n] == 0 {
+		n++
+	}
+	e.control(kind, 8-n)
+	e.buf.Write(b[n:])
+}
+
+func (e *mmdbEncoder) int(v int64) error {
+	if v > math.MaxInt32 {
+		e.uint(mmdbUint64, uint64(v))
+		return nil
+	}
+	if v < math.MinInt32 {
+		return fmt.Errorf("integer %d does not fit in int32", v)
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(int32(v)))
+	e.control(mmdbInt32, 4)
+	e.buf.Write(b[:])
+	return nil
+}
+
+func (e *mmdbEncoder) encode(val interface{}) error {
+	switch v := val.(type) {
+	case string:
+		e.control(mmdbString, len(v))
+		e.buf.WriteString(v)
+	case []byte:
+		e.control(mmdbBytes, len(v))
+		e.buf.Write(v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		e.control(mmdbBool, size)
+	case float64:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+		e.control(mmdbDouble, 8)
+		e.buf.Write(b[:])
+	case float32:
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], math.Float32bits(v))
+		e.control(mmdbFloat, 4)
+		e.buf.Write(b[:])
+	case uint8:
+		e.uint(mmdbUint16, uint64(v))
+	case uint16:
+		e.uint(mmdbUint16, uint64(v))
+	case uint32:
+		e.uint(mmdbUint32, uint64(v))
+	case uint64:
+		e.uint(mmdbUint64, v)
+	case uint:
+		e.uint(mmdbUint64, uint64(v))
+	case int:
+		return e.int(int64(v))
+	case int32:
+		return e.int(int64(v))
+	case int64:
+		return e.int(v)
+	case []interface{}:
+		e.control(mmdbArray, len(v))
+		for _, x := range v {
+			if err := e.encode(x); err != nil {
+				return err
+			}
+		}
+	case []string:
+		e.control(mmdbArray, len(v))
+		for _, x := range v {
+			e.encode(x)
+		}
+	case map[string]interface{}:
+		e.control(mmdbMap, len(v))
+		for _, k := range sortedKeys(v) {
+			e.encode(k)
+			if err := e.encode(v[k]); err != nil {
+				return err
+			}
+		}
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.control(mmdbMap, len(v))
+		for _, k := range keys {
+			e.encode(k)
+			e.encode(v[k])
+		}
+	default:
+		return fmt.Errorf("unsupported MaxMind DB type %T", val)
+	}
+	return nil
+}
+
+// sortedKeys returns map keys in a stable order so identical records
+// encode identically
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
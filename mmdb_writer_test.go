@@ -0,0 +1,145 @@
+package ipv4
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMMDBWriterRoundTrip(t *testing.T) {
+	src := NewIntervalMap(10)
+	values := []struct {
+		left  string
+		right string
+		value interface{}
+	}{
+		{"1.0.0.0", "1.0.0.255", "AU"},
+		{"1.0.1.0", "1.0.3.7", uint64(13335)},
+		{"8.8.8.8", "8.8.8.8", []interface{}{"google", uint64(15169)}},
+		{"9.0.0.1", "9.0.0.254", map[string]interface{}{
+			"asn":  uint64(3356),
+			"org":  "Level 3",
+			"tags": []interface{}{"transit", true},
+		}},
+		{"11.0.0.0", "11.0.0.10", -42},
+		{"11.0.0.11", "11.0.0.12", strings.Repeat("x", 300)},
+		{"11.0.0.13", "11.0.0.20", strings.Repeat("y", 70000)},
+		{"11.0.0.21", "11.0.0.21", 1.5},
+	}
+	for _, v := range values {
+		if err := src.AddRange(v.left, v.right, v.value); err != nil {
+			t.Fatalf("AddRange(%s, %s) failed: %s", v.left, v.right, err)
+		}
+	}
+
+	for _, ipv := range []uint{4, 6} {
+		for _, size := range []uint{0, 24, 28, 32} {
+			w := MMDBWriter{
+				DatabaseType: "Test",
+				RecordSize:   size,
+				IPVersion:    ipv,
+			}
+			buf := bytes.Buffer{}
+			if err := w.Write(&buf, src); err != nil {
+				t.Fatalf("Write(v%d, %d) failed: %s", ipv, size, err)
+			}
+			db, err := NewMMDB(buf.Bytes())
+			if err != nil {
+				t.Fatalf("NewMMDB(v%d, %d) failed: %s", ipv, size, err)
+			}
+			if db.Metadata.IPVersion != ipv || db.Metadata.BuildEpoch == 0 {
+				t.Errorf("Bad metadata: %+v", db.Metadata)
+			}
+			got, err := db.IntervalMap("")
+			if err != nil {
+				t.Fatalf("IntervalMap(v%d, %d) failed: %s", ipv, size, err)
+			}
+			if !reflect.DeepEqual(got.Intervals, src.Intervals) {
+				t.Errorf("Round trip v%d, %d mismatch:\n%s\nwant:\n%s", ipv, size, got, src)
+			}
+		}
+	}
+}
+
+func TestMMDBWriterWholeSpace(t *testing.T) {
+	src := NewIntervalMap(1)
+	if err := src.insert(0, 0xFFFFFFFF, "everything"); err != nil {
+		t.Fatalf("insert failed: %s", err)
+	}
+	if err := src.Valid(); err != nil {
+		t.Fatalf("Valid failed: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if err := (MMDBWriter{}).Write(&buf, src); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	db, err := NewMMDB(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewMMDB failed: %s", err)
+	}
+	for _, addr := range []uint32{0, 0x7FFFFFFF, 0x80000000, 0xFFFFFFFF} {
+		val, err := db.Lookup(addr)
+		if err != nil || val != "everything" {
+			t.Errorf("Lookup(%s) = %v, %v", ToDots(addr), val, err)
+		}
+	}
+}
+
+func TestMMDBWriterErrors(t *testing.T) {
+	src := NewIntervalMap(1)
+	if err := src.Add("10.0.0.1", struct{}{}); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if err := (MMDBWriter{}).Write(&buf, src); err == nil {
+		t.Errorf("Expected error on unsupported type")
+	}
+	if err := (MMDBWriter{IPVersion: 5}).Write(&buf, NewIntervalMap(0)); err == nil {
+		t.Errorf("Expected error on bad ip version")
+	}
+	if err := (MMDBWriter{RecordSize: 20}).Write(&buf, NewIntervalMap(0)); err == nil {
+		t.Errorf("Expected error on bad record size")
+	}
+}
+
+func TestMMDBWriterTypes(t *testing.T) {
+	cases := []struct {
+		written interface{}
+		read    interface{}
+	}{
+		{uint8(7), uint64(7)},
+		{uint16(65535), uint64(65535)},
+		{uint32(1 << 31), uint64(1 << 31)},
+		{uint(9), uint64(9)},
+		{int32(-5), -5},
+		{int64(1 << 40), uint64(1 << 40)},
+		{float32(0.5), float32(0.5)},
+		{[]byte{1, 2}, []byte{1, 2}},
+		{false, false},
+		{[]string{"a", "b"}, []interface{}{"a", "b"}},
+		{map[string]string{"en": "x"}, map[string]interface{}{"en": "x"}},
+		{map[string]interface{}{"ids": []string{"c"}, "n": uint16(3)},
+			map[string]interface{}{"ids": []interface{}{"c"}, "n": uint64(3)}},
+	}
+	src := NewIntervalMap(len(cases))
+	for i, c := range cases {
+		if err := src.add(uint32(i)<<8, uint32(i)<<8|0xFF, c.written); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := (MMDBWriter{}).Write(&buf, src); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	db, err := NewMMDB(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewMMDB failed: %s", err)
+	}
+	for i, c := range cases {
+		got, err := db.Lookup(uint32(i)<<8 | 1)
+		if err != nil || !reflect.DeepEqual(got, c.read) {
+			t.Errorf("%T %v read back as %T %v, %v, want %T %v", c.written, c.written, got, got, err, c.read, c.read)
+		}
+	}
+}
@@ -56,3 +56,52 @@ func IsPrivate(ipdots string) bool {
 
 	return false
 }
+
+// specialPurpose lists the non-global IPv4 blocks, from the IANA IPv4
+// Special-Purpose Address Registry plus multicast and the cloud metadata
+// address.  More specific blocks come first.
+//
+// https://www.iana.org/assignments/iana-ipv4-special-registry/
+var specialPurpose = []struct {
+	left  uint32
+	right uint32
+	name  string
+}{
+	{0x00000000, 0x00FFFFFF, "this network"},       // 0.0.0.0/8
+	{0x0A000000, 0x0AFFFFFF, "private"},            // 10.0.0.0/8
+	{0x64400000, 0x647FFFFF, "shared"},             // 100.64.0.0/10 (CGNAT)
+	{0x7F000000, 0x7FFFFFFF, "loopback"},           // 127.0.0.0/8
+	{0xA9FEA9FE, 0xA9FEA9FE, "metadata"},           // 169.254.169.254/32
+	{0xA9FE0000, 0xA9FEFFFF, "link local"},         // 169.254.0.0/16
+	{0xAC100000, 0xAC1FFFFF, "private"},            // 172.16.0.0/12
+	{0xC0000000, 0xC00000FF, "ietf protocol"},      // 192.0.0.0/24
+	{0xC0000200, 0xC00002FF, "documentation"},      // 192.0.2.0/24
+	{0xC0586300, 0xC05863FF, "6to4 relay anycast"}, // 192.88.99.0/24
+	{0xC0A80000, 0xC0A8FFFF, "private"},            // 192.168.0.0/16
+	{0xC6120000, 0xC613FFFF, "benchmarking"},       // 198.18.0.0/15
+	{0xC6336400, 0xC63364FF, "documentation"},      // 198.51.100.0/24
+	{0xCB007100, 0xCB0071FF, "documentation"},      // 203.0.113.0/24
+	{0xE0000000, 0xEFFFFFFF, "multicast"},          // 224.0.0.0/4
+	{0xFFFFFFFF, 0xFFFFFFFF, "broadcast"},          // 255.255.255.255/32
+	{0xF0000000, 0xFFFFFFFE, "reserved"},           // 240.0.0.0/4
+}
+
+// SpecialPurpose returns the name of the special-purpose block an address
+// is in, such as "private", "loopback", "link local", "shared" (carrier
+// grade NAT) or "metadata", and false for global unicast addresses.
+func SpecialPurpose(addr uint32) (string, bool) {
+	for _, block := range specialPurpose {
+		if block.left <= addr && addr <= block.right {
+			return block.name, true
+		}
+	}
+	return "", false
+}
+
+// IsGlobal returns true if the address is globally routable unicast.  It
+// is stricter than IsPrivate, also excluding carrier grade NAT,
+// documentation, multicast and other reserved blocks.
+func IsGlobal(addr uint32) bool {
+	_, special := SpecialPurpose(addr)
+	return !special
+}
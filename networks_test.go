@@ -77,3 +77,51 @@ func ExampleIsIPv4() {
 	// false
 	// false
 }
+
+func TestSpecialPurpose(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"0.1.2.3", "this network"},
+		{"10.1.2.3", "private"},
+		{"100.64.0.1", "shared"},
+		{"100.127.255.255", "shared"},
+		{"127.0.0.1", "loopback"},
+		{"169.254.169.254", "metadata"},
+		{"169.254.1.1", "link local"},
+		{"172.16.0.1", "private"},
+		{"192.0.0.8", "ietf protocol"},
+		{"192.0.2.1", "documentation"},
+		{"192.88.99.1", "6to4 relay anycast"},
+		{"192.168.1.1", "private"},
+		{"198.19.1.1", "benchmarking"},
+		{"198.51.100.1", "documentation"},
+		{"203.0.113.1", "documentation"},
+		{"224.0.0.1", "multicast"},
+		{"240.0.0.1", "reserved"},
+		{"255.255.255.254", "reserved"},
+		{"255.255.255.255", "broadcast"},
+
+		// global
+		{"1.1.1.1", ""},
+		{"8.8.8.8", ""},
+		{"100.63.255.255", ""},
+		{"100.128.0.0", ""},
+		{"198.20.0.0", ""},
+		{"223.255.255.255", ""},
+	}
+	for _, tt := range tests {
+		addr, _ := FromDots(tt.ip)
+		got, special := SpecialPurpose(addr)
+		if got != tt.want || special != (tt.want != "") {
+			t.Errorf("SpecialPurpose(%q) = %q, %t, want %q", tt.ip, got, special, tt.want)
+		}
+		if IsGlobal(addr) != (tt.want == "") {
+			t.Errorf("IsGlobal(%q) = %t", tt.ip, IsGlobal(addr))
+		}
+		if IsPrivate(tt.ip) && IsGlobal(addr) {
+			t.Errorf("IsPrivate(%q) but IsGlobal", tt.ip)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package ipv4
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Prefix is a CIDR as an address and prefix length
+type Prefix struct {
+	Addr uint32
+	Bits byte
+}
+
+// ParsePrefix parses a CIDR such as "10.0.0.0/8", or a single address as
+// a /32.  Host bits are cleared, so "10.1.2.3/8" is 10.0.0.0/8.
+func ParsePrefix(s string) (Prefix, error) {
+	pos := strings.IndexByte(s, '/')
+	if pos == -1 {
+		addr, err := FromDots(s)
+		if err != nil {
+			return Prefix{}, err
+		}
+		return Prefix{addr, 32}, nil
+	}
+	addr, err := FromDots(s[:pos])
+	if err != nil {
+		return Prefix{}, err
+	}
+	n, err := strconv.Atoi(s[pos+1:])
+	if err != nil || n < 0 || n > 32 || s[pos+1] == '+' {
+		return Prefix{}, fmt.Errorf("Unable to parse %q", s)
+	}
+	return Prefix{Mask(addr, byte(n)), byte(n)}, nil
+}
+
+func (p Prefix) String() string {
+	return fmt.Sprintf("%s/%d", ToDots(p.Addr), p.Bits)
+}
+
+// Last returns the last address in the prefix
+func (p Prefix) Last() uint32 {
+	return p.Addr | uint32(uint64(1)<<(32-p.Bits)-1)
+}
+
+// Contains returns true if addr is in the prefix
+func (p Prefix) Contains(addr uint32) bool {
+	return Mask(addr, p.Bits) == p.Addr
+}
+
+// Covers returns true if q is p or a more specific prefix inside it
+func (p Prefix) Covers(q Prefix) bool {
+	return p.Bits <= q.Bits && Mask(q.Addr, p.Bits) == p.Addr
+}
+
+// PrefixEntry is a prefix and its value in a PrefixTable
+type PrefixEntry struct {
+	Prefix Prefix
+	Value  interface{}
+}
+
+// PrefixTable maps prefixes to values with longest prefix match lookup,
+// like a routing table.  Unlike IntervalMap it keeps the hierarchy: a
+// /24 inside a /8 overrides it for lookups, and deleting the /24 makes
+// the /8 visible again.
+//
+// It is a path compressed binary (Patricia) trie, so lookups take at
+// most 32 steps and memory grows with the number of prefixes.
+//
+// Values are interface{}, like IntervalMap, rather than a type parameter
+// since the module supports Go versions without generics.  Callers type
+// assert the values they stored.
+type PrefixTable struct {
+	root *prefixNode
+	size int
+}
+
+// prefixNode is a node of the trie, glue nodes where two branches split
+// have no value
+type prefixNode struct {
+	prefix   Prefix
+	value    interface{}
+	set      bool
+	children [2]*prefixNode
+}
+
+// NewPrefixTable creates an empty PrefixTable
+func NewPrefixTable() *PrefixTable {
+	return &PrefixTable{}
+}
+
+// bitAt returns bit i of addr, counting from the most significant
+func bitAt(addr uint32, i byte) int {
+	return int(addr >> (31 - i) & 1)
+}
+
+// Len returns the number of prefixes in the table
+func (t *PrefixTable) Len() int {
+	return t.size
+}
+
+// Insert sets the value of a prefix
+func (t *PrefixTable) Insert(p Prefix, value interface{}) {
+	p.Addr = Mask(p.Addr, p.Bits)
+	link := &t.root
+	for {
+		n := *link
+		if n == nil {
+			*link = &prefixNode{prefix: p, value: value, set: true}
+			t.size++
+			return
+		}
+		common := byte(bits.LeadingZeros32(n.prefix.Addr ^ p.Addr))
+		if n.prefix.Bits < common {
+			common = n.prefix.Bits
+		}
+		if p.Bits < common {
+			common = p.Bits
+		}
+		switch {
+		case common == n.prefix.Bits && common == p.Bits:
+			if !n.set {
+				t.size++
+			}
+			n.value, n.set = value, true
+			return
+		case common == n.prefix.Bits:
+			link = &n.children[bitAt(p.Addr, common)]
+			continue
+		case common == p.Bits:
+			leaf := &prefixNode{prefix: p, value: value, set: true}
+			leaf.children[bitAt(n.prefix.Addr, common)] = n
+			*link = leaf
+		default:
+			glue := &prefixNode{prefix: Prefix{Mask(p.Addr, common), common}}
+			glue.children[bitAt(p.Addr, common)] = &prefixNode{prefix: p, value: value, set: true}
+			glue.children[bitAt(n.prefix.Addr, common)] = n
+			*link = glue
+		}
+		t.size++
+		return
+	}
+}
+
+// InsertCIDR is Insert for a CIDR string
+func (t *PrefixTable) InsertCIDR(cidr string, value interface{}) error {
+	p, err := ParsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	t.Insert(p, value)
+	return nil
+}
+
+// Get returns the value of exactly this prefix
+func (t *PrefixTable) Get(p Prefix) (interface{}, bool) {
+	n := t.root
+	for n != nil && n.prefix.Covers(p) {
+		if n.prefix.Bits == p.Bits {
+			return n.value, n.set
+		}
+		n = n.children[bitAt(p.Addr, n.prefix.Bits)]
+	}
+	return nil, false
+}
+
+// Delete removes a prefix, returning false if it was not in the table
+func (t *PrefixTable) Delete(p Prefix) bool {
+	var ok bool
+	t.root, ok = t.delete(t.root, p)
+	if ok {
+		t.size--
+	}
+	return ok
+}
+
+func (t *PrefixTable) delete(n *prefixNode, p Prefix) (*prefixNode, bool) {
+	if n == nil || !n.prefix.Covers(p) {
+		return n, false
+	}
+	if n.prefix.Bits == p.Bits {
+		if !n.set {
+			return n, false
+		}
+		n.value, n.set = nil, false
+		return n.compact(), true
+	}
+	i := bitAt(p.Addr, n.prefix.Bits)
+	child, ok := t.delete(n.children[i], p)
+	if !ok {
+		return n, false
+	}
+	n.children[i] = child
+	return n.compact(), true
+}
+
+// compact removes a glue node that no longer joins two branches
+func (n *prefixNode) compact() *prefixNode {
+	if n.set || (n.children[0] != nil && n.children[1] != nil) {
+		return n
+	}
+	if n.children[0] != nil {
+		return n.children[0]
+	}
+	return n.children[1]
+}
+
+// LongestMatch returns the most specific prefix containing addr
+func (t *PrefixTable) LongestMatch(addr uint32) (Prefix, interface{}, bool) {
+	var best *prefixNode
+	for n := t.root; n != nil && n.prefix.Contains(addr); {
+		if n.set {
+			best = n
+		}
+		if n.prefix.Bits == 32 {
+			break
+		}
+		n = n.children[bitAt(addr, n.prefix.Bits)]
+	}
+	if best == nil {
+		return Prefix{}, nil, false
+	}
+	return best.prefix, best.value, true
+}
+
+// AllMatches returns every prefix containing addr, least specific first
+func (t *PrefixTable) AllMatches(addr uint32) []PrefixEntry {
+	var out []PrefixEntry
+	for n := t.root; n != nil && n.prefix.Contains(addr); {
+		if n.set {
+			out = append(out, PrefixEntry{n.prefix, n.value})
+		}
+		if n.prefix.Bits == 32 {
+			break
+		}
+		n = n.children[bitAt(addr, n.prefix.Bits)]
+	}
+	return out
+}
+
+// Covered returns p, if present, and every more specific prefix inside
+// it, in Walk order
+func (t *PrefixTable) Covered(p Prefix) []PrefixEntry {
+	p.Addr = Mask(p.Addr, p.Bits)
+	n := t.root
+	for n != nil && !p.Covers(n.prefix) {
+		if !n.prefix.Covers(p) {
+			return nil
+		}
+		n = n.children[bitAt(p.Addr, n.prefix.Bits)]
+	}
+	var out []PrefixEntry
+	walkPrefixes(n, func(q Prefix, value interface{}) bool {
+		out = append(out, PrefixEntry{q, value})
+		return true
+	})
+	return out
+}
+
+// Walk calls fn for every prefix in order of address, and shorter
+// prefixes before the longer ones inside them.  It stops if fn returns
+// false.
+func (t *PrefixTable) Walk(fn func(p Prefix, value interface{}) bool) {
+	walkPrefixes(t.root, fn)
+}
+
+func walkPrefixes(n *prefixNode, fn func(Prefix, interface{}) bool) bool {
+	if n == nil {
+		return true
+	}
+	if n.set && !fn(n.prefix, n.value) {
+		return false
+	}
+	return walkPrefixes(n.children[0], fn) && walkPrefixes(n.children[1], fn)
+}
+
+// Flatten returns the table as an IntervalMap, where each address has
+// the value of its longest match.  Prefixes with a nil value are left
+// out, as are the parts of other prefixes they cover.
+func (t *PrefixTable) Flatten() *IntervalMap {
+	out := NewIntervalMap(t.size)
+	var stack []PrefixEntry
+	next := uint64(0)
+
+	// emit fills from next to the end of the innermost covering prefix
+	emit := func(end uint64, value interface{}) {
+		if next <= end && value != nil {
+			out.insert(uint32(next), uint32(end), value)
+		}
+		if next <= end {
+			next = end + 1
+		}
+	}
+	pop := func() {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		emit(uint64(top.Prefix.Last()), top.Value)
+	}
+	t.Walk(func(p Prefix, value interface{}) bool {
+		for len(stack) > 0 && !stack[len(stack)-1].Prefix.Covers(p) {
+			pop()
+		}
+		if len(stack) > 0 && uint64(p.Addr) > next {
+			emit(uint64(p.Addr)-1, stack[len(stack)-1].Value)
+		}
+		next = uint64(p.Addr)
+		stack = append(stack, PrefixEntry{p, value})
+		return true
+	})
+	for len(stack) > 0 {
+		pop()
+	}
+	return out
+}
@@ -0,0 +1,235 @@
+package ipv4
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func mustPrefix(s string) Prefix {
+	p, err := ParsePrefix(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func TestParsePrefix(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"1.2.3.4", "1.2.3.4/32"},
+		{"0.0.0.0/0", "0.0.0.0/0"},
+		{"junk", ""},
+		{"1.2.3.4/33", ""},
+		{"1.2.3.4/+8", ""},
+		{"1.2.3.4/", ""},
+		{"1.2.3/8", ""},
+	}
+	for _, c := range cases {
+		p, err := ParsePrefix(c.in)
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("Expected error on %q", c.in)
+			}
+			continue
+		}
+		if err != nil || p.String() != c.want {
+			t.Errorf("ParsePrefix(%q) = %s, %v, want %s", c.in, p, err, c.want)
+		}
+	}
+	p := mustPrefix("10.0.0.0/8")
+	if p.Last() != 0x0AFFFFFF || !p.Contains(0x0A010203) || p.Contains(0x0B000000) {
+		t.Errorf("Last, Contains wrong for %s", p)
+	}
+	if !p.Covers(mustPrefix("10.1.0.0/16")) || p.Covers(mustPrefix("0.0.0.0/0")) || !p.Covers(p) {
+		t.Errorf("Covers wrong for %s", p)
+	}
+}
+
+func TestPrefixTable(t *testing.T) {
+	tab := NewPrefixTable()
+	for _, e := range []struct {
+		cidr  string
+		value string
+	}{
+		{"10.0.0.0/8", "ten"},
+		{"10.1.0.0/16", "ten-one"},
+		{"10.1.2.0/24", "ten-one-two"},
+		{"10.128.0.0/9", "ten-high"},
+		{"192.168.0.0/16", "private"},
+		{"0.0.0.0/0", "default"},
+		{"10.1.2.3", "host"},
+	} {
+		if err := tab.InsertCIDR(e.cidr, e.value); err != nil {
+			t.Fatalf("InsertCIDR(%s) failed: %s", e.cidr, err)
+		}
+	}
+	if err := tab.InsertCIDR("junk", 1); err == nil {
+		t.Errorf("Expected error on bad CIDR")
+	}
+	if tab.Len() != 7 {
+		t.Errorf("Len = %d, want 7", tab.Len())
+	}
+
+	lookups := []struct {
+		dots string
+		want string
+	}{
+		{"10.1.2.3", "host"},
+		{"10.1.2.4", "ten-one-two"},
+		{"10.1.3.4", "ten-one"},
+		{"10.2.3.4", "ten"},
+		{"10.200.0.1", "ten-high"},
+		{"192.168.1.1", "private"},
+		{"8.8.8.8", "default"},
+	}
+	for _, l := range lookups {
+		addr, _ := FromDots(l.dots)
+		_, v, ok := tab.LongestMatch(addr)
+		if !ok || v != l.want {
+			t.Errorf("LongestMatch(%s) = %v, want %s", l.dots, v, l.want)
+		}
+	}
+
+	var all []string
+	for _, e := range tab.AllMatches(0x0A010203) {
+		all = append(all, e.Prefix.String())
+	}
+	want := []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "10.1.2.3/32"}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("AllMatches = %v, want %v", all, want)
+	}
+
+	var covered []string
+	for _, e := range tab.Covered(mustPrefix("10.0.0.0/15")) {
+		covered = append(covered, e.Prefix.String())
+	}
+	want = []string{"10.1.0.0/16", "10.1.2.0/24", "10.1.2.3/32"}
+	if !reflect.DeepEqual(covered, want) {
+		t.Errorf("Covered = %v, want %v", covered, want)
+	}
+	if got := tab.Covered(mustPrefix("11.0.0.0/8")); got != nil {
+		t.Errorf("Covered(11/8) = %v", got)
+	}
+
+	var walked []string
+	tab.Walk(func(p Prefix, v interface{}) bool {
+		walked = append(walked, p.String())
+		return len(walked) < 4
+	})
+	want = []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24"}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk = %v, want %v", walked, want)
+	}
+
+	// removing the /16 uncovers the /8
+	if v, ok := tab.Get(mustPrefix("10.1.0.0/16")); !ok || v != "ten-one" {
+		t.Errorf("Get = %v, %v", v, ok)
+	}
+	if !tab.Delete(mustPrefix("10.1.0.0/16")) {
+		t.Errorf("Delete failed")
+	}
+	if tab.Delete(mustPrefix("10.1.0.0/16")) || tab.Delete(mustPrefix("10.0.0.0/9")) {
+		t.Errorf("Delete of missing prefix succeeded")
+	}
+	if _, ok := tab.Get(mustPrefix("10.1.0.0/16")); ok {
+		t.Errorf("Get found deleted prefix")
+	}
+	if _, v, _ := tab.LongestMatch(0x0A010304); v != "ten" {
+		t.Errorf("LongestMatch after Delete = %v, want ten", v)
+	}
+	if _, v, _ := tab.LongestMatch(0x0A010203); v != "host" {
+		t.Errorf("LongestMatch after Delete = %v, want host", v)
+	}
+	if tab.Len() != 6 {
+		t.Errorf("Len = %d, want 6", tab.Len())
+	}
+
+	// replacing a value keeps the size
+	tab.InsertCIDR("10.0.0.0/8", "TEN")
+	if _, v, _ := tab.LongestMatch(0x0A050505); v != "TEN" || tab.Len() != 6 {
+		t.Errorf("replace failed: %v, %d", v, tab.Len())
+	}
+}
+
+func TestPrefixTableFlatten(t *testing.T) {
+	tab := NewPrefixTable()
+	tab.InsertCIDR("0.0.0.0/0", "default")
+	tab.InsertCIDR("10.0.0.0/8", "ten")
+	tab.InsertCIDR("10.0.0.0/16", "ten-zero")
+	tab.InsertCIDR("10.255.0.0/16", "ten-top")
+	tab.InsertCIDR("10.1.0.0/16", nil)
+	tab.InsertCIDR("255.255.255.255", "broadcast")
+
+	got := tab.Flatten()
+	want := "0: [0.0.0.0, 9.255.255.255]=default\n" +
+		"1: [10.0.0.0, 10.0.255.255]=ten-zero\n" +
+		"2: [10.2.0.0, 10.254.255.255]=ten\n" +
+		"3: [10.255.0.0, 10.255.255.255]=ten-top\n" +
+		"4: [11.0.0.0, 255.255.255.254]=default\n" +
+		"5: [255.255.255.255, 255.255.255.255]=broadcast\n"
+	if got.String() != want {
+		t.Errorf("Flatten =\n%s\nwant\n%s", got, want)
+	}
+	if err := got.Valid(); err != nil {
+		t.Errorf("Flatten is not valid: %s", err)
+	}
+
+	whole := NewPrefixTable()
+	whole.InsertCIDR("0.0.0.0/0", "default")
+	if err := whole.Flatten().Valid(); err != nil {
+		t.Errorf("Flatten of 0.0.0.0/0 is not valid: %s", err)
+	}
+
+	if NewPrefixTable().Flatten().Len() != 0 {
+		t.Errorf("Flatten of empty table is not empty")
+	}
+}
+
+// TestPrefixTableRandom checks against a brute force lookup
+func TestPrefixTableRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tab := NewPrefixTable()
+	ref := make(map[Prefix]int)
+	for i := 0; i < 2000; i++ {
+		// cluster the prefixes so they nest
+		p := Prefix{r.Uint32() & 0xFF0F0F0F, byte(r.Intn(33))}
+		p.Addr = Mask(p.Addr, p.Bits)
+		if r.Intn(4) == 0 {
+			if _, ok := ref[p]; ok != tab.Delete(p) {
+				t.Fatalf("Delete(%s) disagrees", p)
+			}
+			delete(ref, p)
+			continue
+		}
+		tab.Insert(p, i)
+		ref[p] = i
+	}
+	if tab.Len() != len(ref) {
+		t.Fatalf("Len = %d, want %d", tab.Len(), len(ref))
+	}
+	flat := tab.Flatten()
+	for i := 0; i < 5000; i++ {
+		addr := r.Uint32() & 0xFF0F0F0F
+		var best Prefix
+		want, found := 0, false
+		for p, v := range ref {
+			if p.Contains(addr) && (!found || p.Bits > best.Bits) {
+				best, want, found = p, v, true
+			}
+		}
+		gotp, got, ok := tab.LongestMatch(addr)
+		if ok != found || (found && (got != want || gotp != best)) {
+			t.Fatalf("LongestMatch(%s) = %s %v %v, want %s %v %v",
+				ToDots(addr), gotp, got, ok, best, want, found)
+		}
+		fv := flat.Contains(ToDots(addr))
+		if (found && fv != want) || (!found && fv != nil) {
+			t.Fatalf("Flatten disagrees at %s: %v, want %v", ToDots(addr), fv, want)
+		}
+	}
+}
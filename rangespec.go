@@ -0,0 +1,246 @@
+package ipv4
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Range is a closed range [Left, Right] of IPv4 addresses
+type Range struct {
+	Left  uint32
+	Right uint32
+}
+
+func (r Range) String() string {
+	if r.Left == r.Right {
+		return ToDots(r.Left)
+	}
+	return ToDots(r.Left) + "-" + ToDots(r.Right)
+}
+
+// CIDRs returns the range as a minimal list of CIDRs
+func (r Range) CIDRs() []string {
+	return Range2CIDRs(ToDots(r.Left), ToDots(r.Right))
+}
+
+// RangeMode controls how forgiving ParseRangeSpec is
+type RangeMode int
+
+const (
+	// RangeStrict accepts only well formed specs: no extra whitespace,
+	// ascending ranges and no host bits set in CIDRs or netmasks
+	RangeStrict RangeMode = iota
+
+	// RangeLenient trims whitespace, allows spaces around "-", swaps
+	// descending ranges and clears host bits
+	RangeLenient
+)
+
+// maxRangeSpecRanges limits the expansion of wildcard specs such as
+// "*.*.*.1" which would otherwise produce millions of ranges
+const maxRangeSpecRanges = 1 << 16
+
+// ParseRangeSpec parses the address forms people paste into config:
+//
+//	10.0.0.1                   single address
+//	10.0.0.0/24                CIDR
+//	10.0.0.0 255.255.255.0     address and netmask (also "/255.255.255.0")
+//	10.0.0.1-10.0.0.50         range
+//	10.0.0.1-50                range of the last octet
+//	192.168.*.1                wildcard octet
+//	10.0-3.1.1-254             nmap style octet ranges (also "1,3,5")
+//
+// The result is sorted and non-overlapping.
+func ParseRangeSpec(spec string, mode RangeMode) ([]Range, error) {
+	s := spec
+	if mode == RangeLenient {
+		s = strings.TrimSpace(s)
+	}
+	bad := fmt.Errorf("Unable to parse %q", spec)
+	if s == "" {
+		return nil, bad
+	}
+
+	// single address
+	if addr, err := FromDots(s); err == nil {
+		return []Range{{addr, addr}}, nil
+	}
+
+	// full range "a-b"
+	if pos := strings.IndexByte(s, '-'); pos != -1 && strings.Count(s, ".") == 6 {
+		lefts, rights := s[:pos], s[pos+1:]
+		if mode == RangeLenient {
+			lefts, rights = strings.TrimSpace(lefts), strings.TrimSpace(rights)
+		}
+		left, err := FromDots(lefts)
+		if err != nil {
+			return nil, bad
+		}
+		right, err := FromDots(rights)
+		if err != nil {
+			return nil, bad
+		}
+		if left > right {
+			if mode == RangeStrict {
+				return nil, fmt.Errorf("left %s > right %s", lefts, rights)
+			}
+			left, right = right, left
+		}
+		return []Range{{left, right}}, nil
+	}
+
+	// address and netmask
+	if pos := strings.IndexAny(s, " \t/"); pos != -1 {
+		left := s[:pos]
+		right := s[pos+1:]
+		if mode == RangeLenient {
+			right = strings.TrimSpace(right)
+		}
+		addr, err := FromDots(left)
+		if err != nil {
+			return nil, bad
+		}
+		var ones int
+		if s[pos] == '/' && strings.IndexByte(right, '.') == -1 {
+			ones, err = strconv.Atoi(right)
+			if err != nil || ones < 0 || ones > 32 || right[0] == '+' || right[0] == '-' {
+				return nil, bad
+			}
+		} else {
+			mask, err := FromDots(right)
+			if err != nil {
+				return nil, bad
+			}
+			ones = bits.LeadingZeros32(^mask)
+			if ones < 32 && mask<<uint(ones) != 0 {
+				return nil, fmt.Errorf("Non-contiguous netmask %q", right)
+			}
+		}
+		hostmask := uint32(uint64(1)<<uint(32-ones) - 1)
+		if addr&hostmask != 0 {
+			if mode == RangeStrict {
+				return nil, fmt.Errorf("Host bits set in %q", spec)
+			}
+			addr &^= hostmask
+		}
+		return []Range{{addr, addr | hostmask}}, nil
+	}
+
+	// octet specs with wildcards, lists and ranges
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return nil, bad
+	}
+	var octets [4][]Range
+	for i, part := range parts {
+		for _, item := range strings.Split(part, ",") {
+			r, err := parseOctetSpec(item, mode)
+			if err != nil {
+				return nil, bad
+			}
+			octets[i] = append(octets[i], r)
+		}
+		octets[i] = mergeRanges(octets[i])
+	}
+
+	// octets after the last partial one are complete and so are folded
+	// into the ranges of that octet
+	last := 3
+	for last > 0 && len(octets[last]) == 1 && octets[last][0] == (Range{0, 255}) {
+		last--
+	}
+	var out []Range
+	var expand func(i int, prefix uint32) error
+	expand = func(i int, prefix uint32) error {
+		shift := uint(24 - 8*i)
+		for _, r := range octets[i] {
+			if i == last {
+				if len(out) == maxRangeSpecRanges {
+					return fmt.Errorf("%q expands to too many ranges", spec)
+				}
+				low := uint32(uint64(1)<<shift - 1)
+				out = append(out, Range{prefix | r.Left<<shift, prefix | r.Right<<shift | low})
+				continue
+			}
+			for v := r.Left; v <= r.Right; v++ {
+				if err := expand(i+1, prefix|v<<shift); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := expand(0, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// parseOctetSpec parses "*", "n" or "n-m"
+func parseOctetSpec(s string, mode RangeMode) (Range, error) {
+	if s == "*" {
+		return Range{0, 255}, nil
+	}
+	lo, hi := s, s
+	if pos := strings.IndexByte(s, '-'); pos != -1 {
+		lo, hi = s[:pos], s[pos+1:]
+	}
+	a, err := parseOctet(lo)
+	if err != nil {
+		return Range{}, err
+	}
+	b, err := parseOctet(hi)
+	if err != nil {
+		return Range{}, err
+	}
+	if a > b {
+		if mode == RangeStrict {
+			return Range{}, ErrBadIP
+		}
+		a, b = b, a
+	}
+	return Range{a, b}, nil
+}
+
+func parseOctet(s string) (uint32, error) {
+	if s == "" || len(s) > 3 {
+		return 0, ErrBadIP
+	}
+	var v uint32
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, ErrBadIP
+		}
+		v = v*10 + uint32(s[i]-'0')
+	}
+	if v > 255 {
+		return 0, ErrBadIP
+	}
+	return v, nil
+}
+
+// mergeRanges sorts and coalesces overlapping or adjacent ranges
+func mergeRanges(in []Range) []Range {
+	if len(in) < 2 {
+		return in
+	}
+	for i := 1; i < len(in); i++ {
+		for j := i; j > 0 && in[j].Left < in[j-1].Left; j-- {
+			in[j], in[j-1] = in[j-1], in[j]
+		}
+	}
+	out := in[:1]
+	for _, r := range in[1:] {
+		prev := &out[len(out)-1]
+		if r.Left <= prev.Right || r.Left == prev.Right+1 {
+			if r.Right > prev.Right {
+				prev.Right = r.Right
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
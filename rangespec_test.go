@@ -0,0 +1,136 @@
+package ipv4
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseRangeSpec(t *testing.T) {
+	tests := []struct {
+		spec string
+		mode RangeMode
+		want string
+	}{
+		{"10.0.0.1", RangeStrict, "[10.0.0.1]"},
+		{"10.0.0.0/24", RangeStrict, "[10.0.0.0-10.0.0.255]"},
+		{"0.0.0.0/0", RangeStrict, "[0.0.0.0-255.255.255.255]"},
+		{"10.0.0.0 255.255.255.0", RangeStrict, "[10.0.0.0-10.0.0.255]"},
+		{"10.0.0.0/255.255.0.0", RangeStrict, "[10.0.0.0-10.0.255.255]"},
+		{"10.0.0.1-10.0.0.50", RangeStrict, "[10.0.0.1-10.0.0.50]"},
+		{"10.0.0.1-50", RangeStrict, "[10.0.0.1-10.0.0.50]"},
+		{"192.168.*.1", RangeStrict, ""},
+		{"192.168.1.*", RangeStrict, "[192.168.1.0-192.168.1.255]"},
+		{"10.*.*.*", RangeStrict, "[10.0.0.0-10.255.255.255]"},
+		{"10.0-3.*.*", RangeStrict, "[10.0.0.0-10.3.255.255]"},
+		{"10.0-1.1.1-254", RangeStrict, "[10.0.1.1-10.0.1.254 10.1.1.1-10.1.1.254]"},
+		{"10.0.0.1,3,5-6", RangeStrict, "[10.0.0.1 10.0.0.3 10.0.0.5-10.0.0.6]"},
+		{"10.0.0.5,1-3,4", RangeStrict, "[10.0.0.1-10.0.0.5]"},
+
+		{" 10.0.0.1 - 10.0.0.50 ", RangeLenient, "[10.0.0.1-10.0.0.50]"},
+		{"10.0.0.50-10.0.0.1", RangeLenient, "[10.0.0.1-10.0.0.50]"},
+		{"10.0.0.1/24", RangeLenient, "[10.0.0.0-10.0.0.255]"},
+		{"10.0.0.1  255.255.255.0", RangeLenient, "[10.0.0.0-10.0.0.255]"},
+		{"10.0.0.50-1", RangeLenient, "[10.0.0.1-10.0.0.50]"},
+
+		// errors
+		{"", RangeStrict, "error"},
+		{"busted", RangeStrict, "error"},
+		{" 10.0.0.1", RangeStrict, "error"},
+		{"10.0.0.1 - 10.0.0.50", RangeStrict, "error"},
+		{"10.0.0.50-10.0.0.1", RangeStrict, "error"},
+		{"10.0.0.1/24", RangeStrict, "error"},
+		{"10.0.0.0/33", RangeStrict, "error"},
+		{"10.0.0.0/-1", RangeStrict, "error"},
+		{"10.0.0.0/", RangeStrict, "error"},
+		{"10.0.0.0 255.0.255.0", RangeLenient, "error"},
+		{"10.0.0.50-1", RangeStrict, "error"},
+		{"10.0.0.1-256", RangeStrict, "error"},
+		{"10.0.0", RangeStrict, "error"},
+		{"10.0.0.0.1", RangeStrict, "error"},
+		{"10.0.0.1,", RangeStrict, "error"},
+		{"*.*.*.1", RangeStrict, "error"},
+		{"10.0.0.1-10.0.0", RangeStrict, "error"},
+	}
+	for _, tt := range tests {
+		got, err := ParseRangeSpec(tt.spec, tt.mode)
+		if tt.want == "error" {
+			if err == nil {
+				t.Errorf("ParseRangeSpec(%q) = %v, expected error", tt.spec, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRangeSpec(%q) error: %s", tt.spec, err)
+			continue
+		}
+		if tt.want == "" {
+			continue
+		}
+		if s := fmt.Sprint(got); s != tt.want {
+			t.Errorf("ParseRangeSpec(%q) = %s, want %s", tt.spec, s, tt.want)
+		}
+	}
+
+	// wildcard in the middle expands to one range per value
+	got, err := ParseRangeSpec("192.168.*.1", RangeStrict)
+	if err != nil || len(got) != 256 || got[255].String() != "192.168.255.1" {
+		t.Errorf("ParseRangeSpec(192.168.*.1) = %d ranges, %v", len(got), err)
+	}
+}
+
+func TestRangeCIDRs(t *testing.T) {
+	r := Range{0x0A000001, 0x0A000006}
+	got := fmt.Sprint(r.CIDRs())
+	if got != "[10.0.0.1/32 10.0.0.2/31 10.0.0.4/31 10.0.0.6/32]" {
+		t.Errorf("CIDRs() = %s", got)
+	}
+}
+
+func TestIntervalMapAddSpec(t *testing.T) {
+	m := NewIntervalMap(10)
+	for _, spec := range []string{"10.0.0.1-50", "192.168.*.1", "172.16.0.0/255.255.255.0"} {
+		if err := m.Add(spec, spec); err != nil {
+			t.Errorf("Add(%q) failed: %s", spec, err)
+		}
+	}
+	if m.Len() != 258 {
+		t.Errorf("Expected 258 intervals, got %d", m.Len())
+	}
+	if m.Contains("10.0.0.50") != "10.0.0.1-50" || m.Contains("192.168.7.1") != "192.168.*.1" ||
+		m.Contains("192.168.7.2") != nil || m.Contains("172.16.0.9") != "172.16.0.0/255.255.255.0" {
+		t.Errorf("Unexpected lookups")
+	}
+	if err := m.Add("10.0.0.1 - 50", true); err == nil {
+		t.Errorf("Expected error on lenient syntax")
+	}
+}
+
+func TestSetAddAllSpec(t *testing.T) {
+	s := Set{}
+	if s.AddAll([]string{"10.0.0.1-3", "10.0.0.2", "192.168.0.0/31", "junk"}) {
+		t.Errorf("AddAll did not report the junk entry")
+	}
+	got := fmt.Sprint(s.ToDots())
+	if got != "[10.0.0.1 10.0.0.2 10.0.0.3 192.168.0.0 192.168.0.1]" {
+		t.Errorf("AddAll = %s", got)
+	}
+}
+
+func TestSetAddAllLimit(t *testing.T) {
+	s := Set{}
+	if s.AddAll([]string{"10.0.0.0/24", "0.0.0.0/0", "11.0.0.1"}) {
+		t.Errorf("AddAll did not report the /0")
+	}
+	if s.Len() != 257 {
+		t.Errorf("Expected 257 addresses, got %d", s.Len())
+	}
+
+	// the limit is on the total
+	s = Set{}
+	if s.AddAll([]string{"10.0.0.0/12", "11.0.0.0/12", "12.0.0.0/32"}) {
+		t.Errorf("AddAll did not report going over the limit")
+	}
+	if s.Len() != maxSetExpansion || !s.Contains("10.15.255.255") || s.Contains("11.0.0.0") {
+		t.Errorf("Unexpected set of %d addresses", s.Len())
+	}
+}
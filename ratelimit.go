@@ -0,0 +1,190 @@
+package ipv4
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Clock tells the time.  It can be replaced to control time in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// RateLevel is a token bucket applied to every prefix of a length, such
+// as 1000 requests per second from each /24
+type RateLevel struct {
+	Bits  byte    // prefix length the bucket is keyed by
+	Rate  float64 // tokens added per second
+	Burst float64 // bucket size, Rate if zero
+}
+
+// RatePolicy replaces the default levels for the networks it is
+// assigned to in RateLimiter.Overrides
+type RatePolicy struct {
+	Exempt bool        // never limited
+	Levels []RateLevel // used in place of RateLimiter.Levels
+}
+
+// DefaultMaxBuckets is the number of buckets a RateLimiter keeps when
+// MaxBuckets is zero
+const DefaultMaxBuckets = 100000
+
+// RateLimiter limits requests at several prefix levels at once.  A
+// request is allowed only if every level has a token for it, in which
+// case a token is taken from each.
+//
+//	l := ipv4.NewRateLimiter(
+//		ipv4.RateLevel{Bits: 32, Rate: 100},
+//		ipv4.RateLevel{Bits: 24, Rate: 1000},
+//		ipv4.RateLevel{Bits: 16, Rate: 10000},
+//	)
+//	if !l.Allow(addr) {
+//		// 429
+//	}
+//
+// Memory is bounded by MaxBuckets, the least recently used buckets are
+// dropped first.  A dropped bucket starts full if its prefix comes back,
+// so MaxBuckets should be well above the number of prefixes active
+// within the time it takes a bucket to refill.
+//
+// A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	Levels []RateLevel
+
+	// Overrides maps networks to a *RatePolicy.  Networks with a policy
+	// use their own buckets, separate from the default levels.
+	Overrides *IntervalMap
+
+	MaxBuckets int
+	Clock      Clock
+
+	mu      sync.Mutex
+	buckets map[rateKey]*list.Element
+	lru     list.List
+}
+
+type rateKey struct {
+	prefix uint32
+	bits   byte
+	policy *RatePolicy
+}
+
+type rateBucket struct {
+	key    rateKey
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a RateLimiter with the given levels
+func NewRateLimiter(levels ...RateLevel) *RateLimiter {
+	return &RateLimiter{Levels: levels}
+}
+
+// Allow reports whether a request from addr may go ahead
+func (l *RateLimiter) Allow(addr uint32) bool {
+	return l.AllowN(addr, 1)
+}
+
+// AllowDots is Allow for dotted addresses
+func (l *RateLimiter) AllowDots(dots string) (bool, error) {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return false, err
+	}
+	return l.AllowN(addr, 1), nil
+}
+
+// AllowN reports whether n tokens are available at every level for addr,
+// and takes them if so
+func (l *RateLimiter) AllowN(addr uint32, n float64) bool {
+	levels := l.Levels
+	var policy *RatePolicy
+	if l.Overrides != nil {
+		if p, ok := l.Overrides.lookup(addr).(*RatePolicy); ok && p != nil {
+			if p.Exempt {
+				return true
+			}
+			levels = p.Levels
+			policy = p
+		}
+	}
+
+	clock := l.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+	now := clock.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[rateKey]*list.Element)
+	}
+
+	var stack [4]*rateBucket
+	buckets := stack[:0]
+	allowed := true
+	for _, level := range levels {
+		burst := level.Burst
+		if burst == 0 {
+			burst = level.Rate
+		}
+		b := l.bucket(rateKey{Mask(addr, level.Bits), level.Bits, policy}, burst, now)
+		if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+			b.tokens += elapsed * level.Rate
+			if b.tokens > burst {
+				b.tokens = burst
+			}
+			b.last = now
+		}
+		if b.tokens < n {
+			allowed = false
+		}
+		buckets = append(buckets, b)
+	}
+	if allowed {
+		for _, b := range buckets {
+			b.tokens -= n
+		}
+	}
+	l.evict()
+	return allowed
+}
+
+// bucket returns the bucket for a key, creating a full one if needed
+func (l *RateLimiter) bucket(key rateKey, burst float64, now time.Time) *rateBucket {
+	if e, ok := l.buckets[key]; ok {
+		l.lru.MoveToFront(e)
+		return e.Value.(*rateBucket)
+	}
+	b := &rateBucket{key: key, tokens: burst, last: now}
+	l.buckets[key] = l.lru.PushFront(b)
+	return b
+}
+
+// evict drops the least recently used buckets over MaxBuckets
+func (l *RateLimiter) evict() {
+	max := l.MaxBuckets
+	if max <= 0 {
+		max = DefaultMaxBuckets
+	}
+	for l.lru.Len() > max {
+		e := l.lru.Back()
+		l.lru.Remove(e)
+		delete(l.buckets, e.Value.(*rateBucket).key)
+	}
+}
+
+// Len returns the number of buckets being tracked
+func (l *RateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lru.Len()
+}
@@ -0,0 +1,174 @@
+package ipv4
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// allowed counts how many of n requests from dots are allowed
+func allowed(l *RateLimiter, dots string, n int) int {
+	count := 0
+	for i := 0; i < n; i++ {
+		if ok, _ := l.AllowDots(dots); ok {
+			count++
+		}
+	}
+	return count
+}
+
+func TestRateLimiterLevels(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(
+		RateLevel{Bits: 32, Rate: 10},
+		RateLevel{Bits: 24, Rate: 25},
+	)
+	l.Clock = clock
+
+	if n := allowed(l, "10.0.0.1", 20); n != 10 {
+		t.Errorf("/32 allowed %d, want 10", n)
+	}
+	if n := allowed(l, "10.0.0.2", 20); n != 10 {
+		t.Errorf("second /32 allowed %d, want 10", n)
+	}
+	// the /24 has 5 tokens left
+	if n := allowed(l, "10.0.0.3", 20); n != 5 {
+		t.Errorf("third /32 allowed %d, want 5", n)
+	}
+	// a different /24 is unaffected
+	if n := allowed(l, "10.0.1.1", 20); n != 10 {
+		t.Errorf("other /24 allowed %d, want 10", n)
+	}
+
+	// refill a bit: 0.5s gives 5 tokens per /32 and 12.5 per /24
+	clock.Advance(500 * time.Millisecond)
+	if n := allowed(l, "10.0.0.1", 20); n != 5 {
+		t.Errorf("after refill allowed %d, want 5", n)
+	}
+	if n := allowed(l, "10.0.0.4", 20); n != 7 {
+		t.Errorf("after refill allowed %d, want 7", n)
+	}
+
+	// a denied request takes no tokens from any level
+	clock.Advance(time.Minute)
+	if l.AllowN(0x0A000001, 11) {
+		t.Errorf("AllowN over the burst should fail")
+	}
+	if n := allowed(l, "10.0.0.1", 20); n != 10 {
+		t.Errorf("after denied AllowN allowed %d, want 10", n)
+	}
+
+	if _, err := l.AllowDots("junk"); err == nil {
+		t.Errorf("Expected error on bad address")
+	}
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLevel{Bits: 32, Rate: 1, Burst: 3})
+	l.Clock = clock
+	if n := allowed(l, "1.2.3.4", 10); n != 3 {
+		t.Errorf("allowed %d, want 3", n)
+	}
+	clock.Advance(time.Hour)
+	if n := allowed(l, "1.2.3.4", 10); n != 3 {
+		t.Errorf("allowed %d after an hour, want 3", n)
+	}
+}
+
+func TestRateLimiterOverrides(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLevel{Bits: 32, Rate: 2})
+	l.Clock = clock
+	l.Overrides = NewIntervalMap(0)
+	l.Overrides.Add("192.168.0.0/16", &RatePolicy{Exempt: true})
+	l.Overrides.Add("10.0.0.0/8", &RatePolicy{Levels: []RateLevel{
+		{Bits: 32, Rate: 5},
+		{Bits: 8, Rate: 7},
+	}})
+
+	if n := allowed(l, "192.168.1.1", 100); n != 100 {
+		t.Errorf("exempt allowed %d, want 100", n)
+	}
+	if n := allowed(l, "1.1.1.1", 10); n != 2 {
+		t.Errorf("default allowed %d, want 2", n)
+	}
+	if n := allowed(l, "10.1.1.1", 10); n != 5 {
+		t.Errorf("custom allowed %d, want 5", n)
+	}
+	if n := allowed(l, "10.2.2.2", 10); n != 2 {
+		t.Errorf("custom /8 allowed %d, want 2", n)
+	}
+}
+
+func TestRateLimiterEviction(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLevel{Bits: 32, Rate: 1}, RateLevel{Bits: 16, Rate: 1000})
+	l.Clock = clock
+	l.MaxBuckets = 10
+	for i := uint32(0); i < 100; i++ {
+		l.Allow(0x01010000 + i)
+	}
+	if l.Len() != 10 {
+		t.Errorf("Len = %d, want 10", l.Len())
+	}
+
+	// the busy /16 bucket stays, the oldest /32 was dropped and so is
+	// allowed again
+	if l.Allow(0x01010063) {
+		t.Errorf("recent address should still be limited")
+	}
+	if !l.Allow(0x01010000) {
+		t.Errorf("evicted address should start with a full bucket")
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	clock := newFakeClock()
+	l := NewRateLimiter(RateLevel{Bits: 24, Rate: 100})
+	l.Clock = clock
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			n := 0
+			for i := 0; i < 50; i++ {
+				if l.Allow(0x0A000000 + uint32(g)) {
+					n++
+				}
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}(g)
+	}
+	wg.Wait()
+	if total != 100 {
+		t.Errorf("allowed %d, want 100", total)
+	}
+}
@@ -0,0 +1,163 @@
+package ipv4
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const reverseSuffix = ".in-addr.arpa."
+
+// ToReverseName returns the PTR owner name of an address, so 1.2.3.4
+// becomes "4.3.2.1.in-addr.arpa."
+func ToReverseName(addr uint32) string {
+	return fmt.Sprintf("%d.%d.%d.%d%s",
+		addr&0xFF, addr>>8&0xFF, addr>>16&0xFF, addr>>24, reverseSuffix)
+}
+
+// ParseReverseName converts a PTR owner name back to an address.  The
+// trailing dot is optional and the suffix is matched case-insensitively.
+func ParseReverseName(name string) (uint32, error) {
+	labels, err := reverseLabels(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(labels) != 4 {
+		return 0, fmt.Errorf("%q is not a full in-addr.arpa name", name)
+	}
+	return FromDots(labels[3] + "." + labels[2] + "." + labels[1] + "." + labels[0])
+}
+
+// reverseLabels returns the labels before the in-addr.arpa suffix
+func reverseLabels(name string) ([]string, error) {
+	trimmed := strings.TrimSuffix(name, ".")
+	suffix := reverseSuffix[:len(reverseSuffix)-1]
+	if len(trimmed) < len(suffix) || !strings.EqualFold(trimmed[len(trimmed)-len(suffix):], suffix) {
+		return nil, fmt.Errorf("%q is not in in-addr.arpa", name)
+	}
+	prefix := trimmed[:len(trimmed)-len(suffix)]
+	if prefix == "" {
+		return nil, nil
+	}
+	return strings.Split(prefix, "."), nil
+}
+
+// ReverseZones returns the reverse zones that hold the PTR records of a
+// CIDR.  Prefixes on an octet boundary map to one zone, shorter ones are
+// split into several, and prefixes longer than /24 use the classless
+// delegation names of RFC 2317:
+//
+//	10.0.0.0/8      10.in-addr.arpa.
+//	192.0.0.0/22    0.0.192.in-addr.arpa. ... 3.0.192.in-addr.arpa.
+//	192.0.2.0/26    0/26.2.0.192.in-addr.arpa.
+func ReverseZones(cidr string) ([]string, error) {
+	leftdots, rightdots, err := CIDR2Range(cidr)
+	if err != nil {
+		return nil, err
+	}
+	left, _ := FromDots(leftdots)
+	right, _ := FromDots(rightdots)
+	bits := 32
+	for size := right - left; size != 0; size >>= 1 {
+		bits--
+	}
+
+	if bits > 24 {
+		return []string{fmt.Sprintf("%d/%d.%d.%d.%d%s",
+			left&0xFF, bits, left>>8&0xFF, left>>16&0xFF, left>>24, reverseSuffix)}, nil
+	}
+
+	// round up to the zone boundary, each zone covers 2^step addresses
+	octets := (bits + 7) / 8
+	if octets == 0 {
+		octets = 1
+	}
+	step := uint(32 - 8*octets)
+	var zones []string
+	for zone := uint64(left); zone <= uint64(right); zone += uint64(1) << step {
+		labels := make([]string, 0, octets)
+		for i := octets - 1; i >= 0; i-- {
+			labels = append(labels, strconv.FormatUint(zone>>uint(24-8*i)&0xFF, 10))
+		}
+		zones = append(zones, strings.Join(labels, ".")+reverseSuffix)
+	}
+	return zones, nil
+}
+
+// RangeReverseZones returns the reverse zones for a range of dotted
+// addresses, by way of Range2CIDRs
+func RangeReverseZones(dots1, dots2 string) ([]string, error) {
+	cidrs := Range2CIDRs(dots1, dots2)
+	if cidrs == nil {
+		return nil, fmt.Errorf("Invalid range [%s, %s]", dots1, dots2)
+	}
+	var zones []string
+	seen := make(map[string]bool)
+	for _, cidr := range cidrs {
+		more, err := ReverseZones(cidr)
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range more {
+			if !seen[z] {
+				seen[z] = true
+				zones = append(zones, z)
+			}
+		}
+	}
+	return zones, nil
+}
+
+// ClasslessPTRName returns the owner name of an address's PTR record in
+// an RFC 2317 classless zone of the given prefix length, such as
+// "5.0/26.2.0.192.in-addr.arpa.".  The parent /24 zone holds a CNAME
+// from the ToReverseName name to this one.  For prefixes of /24 or
+// shorter it is the same as ToReverseName.
+func ClasslessPTRName(addr uint32, bits byte) string {
+	if bits <= 24 || bits > 32 {
+		return ToReverseName(addr)
+	}
+	hostmask := uint32(1)<<(32-bits) - 1
+	return fmt.Sprintf("%d.%d/%d.%d.%d.%d%s",
+		addr&0xFF, addr&^hostmask&0xFF, bits,
+		addr>>8&0xFF, addr>>16&0xFF, addr>>24, reverseSuffix)
+}
+
+// ParseReverseZone converts a reverse zone name, including RFC 2317
+// classless ones, to the CIDR it covers
+func ParseReverseZone(zone string) (string, error) {
+	labels, err := reverseLabels(zone)
+	if err != nil {
+		return "", err
+	}
+	if len(labels) == 0 || len(labels) > 4 {
+		return "", fmt.Errorf("%q is not a reverse zone", zone)
+	}
+
+	var addr uint32
+	bits := 8 * len(labels)
+	for i, label := range labels {
+		// the first label may be an RFC 2317 "start/bits"
+		if i == 0 && len(labels) == 4 {
+			pos := strings.IndexByte(label, '/')
+			if pos == -1 {
+				return "", fmt.Errorf("%q is not a reverse zone", zone)
+			}
+			n, err := strconv.Atoi(label[pos+1:])
+			if err != nil || n <= 24 || n > 32 {
+				return "", fmt.Errorf("%q has a bad prefix length", zone)
+			}
+			bits = n
+			label = label[:pos]
+		}
+		octet, err := parseOctet(label)
+		if err != nil {
+			return "", fmt.Errorf("%q has a bad label %q", zone, label)
+		}
+		addr |= octet << uint(8*(4-len(labels)+i))
+	}
+	if addr&(uint32(uint64(1)<<uint(32-bits)-1)) != 0 {
+		return "", fmt.Errorf("%q does not start on a /%d boundary", zone, bits)
+	}
+	return fmt.Sprintf("%s/%d", ToDots(addr), bits), nil
+}
@@ -0,0 +1,120 @@
+package ipv4
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestReverseName(t *testing.T) {
+	addr, _ := FromDots("1.2.3.4")
+	name := ToReverseName(addr)
+	if name != "4.3.2.1.in-addr.arpa." {
+		t.Errorf("ToReverseName = %q", name)
+	}
+	for _, in := range []string{name, "4.3.2.1.in-addr.arpa", "4.3.2.1.IN-ADDR.ARPA."} {
+		got, err := ParseReverseName(in)
+		if err != nil || got != addr {
+			t.Errorf("ParseReverseName(%q) = %s, %v", in, ToDots(got), err)
+		}
+	}
+	for _, in := range []string{"3.2.1.in-addr.arpa.", "4.3.2.1.ip6.arpa.", "x.3.2.1.in-addr.arpa", "5.4.3.2.1.in-addr.arpa",
+		"\xff\xff\xff\xff\xff\xff\xff\xff.in-addr.arpa.", "4.3.2.\u0130.in-addr.arpa.", "4.3.2.1.\u0130n-addr.arpa.", "in-addr.arpa."} {
+		if _, err := ParseReverseName(in); err == nil {
+			t.Errorf("ParseReverseName(%q) expected error", in)
+		}
+	}
+}
+
+func TestReverseZones(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"10.0.0.0/8", "[10.in-addr.arpa.]"},
+		{"10.0.0.0/7", "[10.in-addr.arpa. 11.in-addr.arpa.]"},
+		{"172.16.0.0/12", "[16.172.in-addr.arpa. 17.172.in-addr.arpa. 18.172.in-addr.arpa. 19.172.in-addr.arpa. 20.172.in-addr.arpa. 21.172.in-addr.arpa. 22.172.in-addr.arpa. 23.172.in-addr.arpa. 24.172.in-addr.arpa. 25.172.in-addr.arpa. 26.172.in-addr.arpa. 27.172.in-addr.arpa. 28.172.in-addr.arpa. 29.172.in-addr.arpa. 30.172.in-addr.arpa. 31.172.in-addr.arpa.]"},
+		{"192.168.0.0/16", "[168.192.in-addr.arpa.]"},
+		{"192.0.0.0/22", "[0.0.192.in-addr.arpa. 1.0.192.in-addr.arpa. 2.0.192.in-addr.arpa. 3.0.192.in-addr.arpa.]"},
+		{"192.0.2.0/24", "[2.0.192.in-addr.arpa.]"},
+		{"192.0.2.0/26", "[0/26.2.0.192.in-addr.arpa.]"},
+		{"192.0.2.64/26", "[64/26.2.0.192.in-addr.arpa.]"},
+		{"192.0.2.5/32", "[5/32.2.0.192.in-addr.arpa.]"},
+	}
+	for _, tt := range tests {
+		got, err := ReverseZones(tt.cidr)
+		if err != nil || fmt.Sprint(got) != tt.want {
+			t.Errorf("ReverseZones(%q) = %v, %v, want %s", tt.cidr, got, err, tt.want)
+		}
+	}
+	if _, err := ReverseZones("busted"); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestRangeReverseZones(t *testing.T) {
+	got, err := RangeReverseZones("192.0.2.0", "192.0.3.127")
+	want := "[2.0.192.in-addr.arpa. 0/25.3.0.192.in-addr.arpa.]"
+	if err != nil || fmt.Sprint(got) != want {
+		t.Errorf("RangeReverseZones = %v, %v, want %s", got, err, want)
+	}
+	if _, err := RangeReverseZones("192.0.3.0", "192.0.2.0"); err == nil {
+		t.Errorf("Expected error")
+	}
+}
+
+func TestClasslessPTRName(t *testing.T) {
+	addr, _ := FromDots("192.0.2.69")
+	if got := ClasslessPTRName(addr, 26); got != "69.64/26.2.0.192.in-addr.arpa." {
+		t.Errorf("ClasslessPTRName(/26) = %q", got)
+	}
+	if got := ClasslessPTRName(addr, 24); got != ToReverseName(addr) {
+		t.Errorf("ClasslessPTRName(/24) = %q", got)
+	}
+}
+
+func TestParseReverseZone(t *testing.T) {
+	tests := []struct {
+		zone string
+		want string
+	}{
+		{"10.in-addr.arpa.", "10.0.0.0/8"},
+		{"168.192.in-addr.arpa", "192.168.0.0/16"},
+		{"2.0.192.in-addr.arpa.", "192.0.2.0/24"},
+		{"0/26.2.0.192.in-addr.arpa.", "192.0.2.0/26"},
+		{"128/25.2.0.192.in-addr.arpa.", "192.0.2.128/25"},
+		{"64/25.2.0.192.in-addr.arpa.", ""},
+		{"0/24.2.0.192.in-addr.arpa.", ""},
+		{"1.2.0.192.in-addr.arpa.", ""},
+		{"300.in-addr.arpa.", ""},
+		{"example.com.", ""},
+		{"\xff\xff\xff\xff\xff\xff\xff\xff.in-addr.arpa.", ""},
+		{"\u0130\u0130.in-addr.arpa.", ""},
+		{"2.0.192.\u0130N-ADDR.ARPA.", ""},
+		{"2.0.192.IN-ADDR.ARPA", "192.0.2.0/24"},
+	}
+	for _, tt := range tests {
+		got, err := ParseReverseZone(tt.zone)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ParseReverseZone(%q) = %q, expected error", tt.zone, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseReverseZone(%q) = %q, %v, want %q", tt.zone, got, err, tt.want)
+		}
+		// and back again
+		zones, err := ReverseZones(got)
+		if err != nil || len(zones) != 1 || mustParseReverseZone(t, zones[0]) != got {
+			t.Errorf("ReverseZones(%q) = %v, %v", got, zones, err)
+		}
+	}
+}
+
+func mustParseReverseZone(t *testing.T, zone string) string {
+	cidr, err := ParseReverseZone(zone)
+	if err != nil {
+		t.Fatalf("ParseReverseZone(%q) failed: %s", zone, err)
+	}
+	return cidr
+}
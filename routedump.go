@@ -0,0 +1,512 @@
+package ipv4
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Route is a route read from a routing table dump
+type Route struct {
+	Prefix    Prefix
+	NextHop   uint32 // 0 for directly connected and unreachable routes
+	Interface string
+	Protocol  string // such as "bgp1" for BIRD, "B" or "O" for Cisco
+	Best      bool   // marked as the selected route
+	ASPath    []uint32
+
+	// ASN is the origin AS, the last of the AS path
+	ASN uint32
+}
+
+func (r *Route) String() string {
+	s := r.Prefix.String()
+	if r.NextHop != 0 {
+		s += " via " + ToDots(r.NextHop)
+	}
+	if r.Interface != "" {
+		s += " dev " + r.Interface
+	}
+	if r.ASN != 0 {
+		s += fmt.Sprintf(" AS%d", r.ASN)
+	}
+	return s
+}
+
+// InsertRoute adds a route to the table, with the *Route as its value.
+// The first route read for a prefix is kept unless a later one is marked
+// Best.  It can be passed straight to the route readers:
+//
+//	t := ipv4.NewPrefixTable()
+//	diags, err := ipv4.ReadBIRDRoutes(f, t.InsertRoute)
+func (t *PrefixTable) InsertRoute(r *Route) error {
+	if old, ok := t.Get(r.Prefix); ok {
+		if prev, isRoute := old.(*Route); isRoute && (prev.Best || !r.Best) {
+			return nil
+		}
+	}
+	t.Insert(r.Prefix, r)
+	return nil
+}
+
+// callbackError is an error from the caller's function, which stops
+// reading
+type callbackError struct {
+	err error
+}
+
+func (e callbackError) Error() string {
+	return e.err.Error()
+}
+
+// readRouteLines runs a line parser over a text dump.  Errors from parse
+// are diagnostics unless they are a callbackError.
+func readRouteLines(r io.Reader, parse func(line int, text string) error) ([]*LineError, error) {
+	var diags []*LineError
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := parse(line, scanner.Text()); err != nil {
+			if cerr, ok := err.(callbackError); ok {
+				return diags, cerr.err
+			}
+			diags = append(diags, &LineError{Line: line, Err: err})
+		}
+	}
+	return diags, scanner.Err()
+}
+
+// ReadBIRDRoutes parses the output of BIRD's "show route" or "show route
+// all", in the BIRD 1 or BIRD 2 layout, calling fn for each IPv4 route:
+//
+//	1.0.0.0/24   via 192.0.2.1 on eth0 [bgp1 2020-01-01] * (100) [AS13335i]
+//	             via 192.0.2.2 on eth0 [bgp2 2020-01-01] (100) [AS13335i]
+//
+//	1.0.0.0/24           unicast [bgp1 2020-01-01] * (100) [AS13335i]
+//		via 192.0.2.1 on eth0
+//		BGP.as_path: 174 13335
+//
+// Alternative routes for a prefix are passed to fn as separate routes.
+// Lines that can not be parsed are returned as diagnostics, the error is
+// from reading or from fn.
+func ReadBIRDRoutes(r io.Reader, fn func(*Route) error) ([]*LineError, error) {
+	var cur *Route
+	curLine := 0
+	flush := func() error {
+		if cur == nil {
+			return nil
+		}
+		route := cur
+		cur = nil
+		if n := len(route.ASPath); n > 0 {
+			route.ASN = route.ASPath[n-1]
+		}
+		if err := fn(route); err != nil {
+			return callbackError{&LineError{Line: curLine, Err: err}}
+		}
+		return nil
+	}
+	var prefix Prefix
+	var skipping bool
+	diags, err := readRouteLines(r, func(line int, text string) error {
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case trimmed == "", strings.HasPrefix(trimmed, "BIRD "),
+			strings.HasPrefix(trimmed, "Table "), strings.HasPrefix(trimmed, "Access restricted"):
+			return flush()
+		case text[0] != ' ' && text[0] != '\t':
+			// a new prefix
+			if err := flush(); err != nil {
+				return err
+			}
+			fields := strings.Fields(text)
+			if strings.IndexByte(fields[0], ':') != -1 {
+				skipping = true
+				return nil
+			}
+			p, err := ParsePrefix(fields[0])
+			if err != nil {
+				skipping = true
+				return err
+			}
+			prefix, skipping = p, false
+			cur, curLine = parseBIRDRoute(prefix, trimmed[len(fields[0]):]), line
+			return nil
+		case skipping:
+			return nil
+		case strings.IndexByte(trimmed, '[') != -1:
+			// another route for the same prefix
+			if err := flush(); err != nil {
+				return err
+			}
+			cur, curLine = parseBIRDRoute(prefix, trimmed), line
+			return nil
+		case cur == nil:
+			return nil
+		case strings.HasPrefix(trimmed, "via ") || strings.HasPrefix(trimmed, "dev "):
+			parseBIRDNextHop(cur, strings.Fields(trimmed))
+		case strings.HasPrefix(trimmed, "BGP.as_path:"):
+			path, err := parseASPath(strings.Fields(trimmed[len("BGP.as_path:"):]))
+			if err != nil {
+				return err
+			}
+			cur.ASPath = path
+		case strings.HasPrefix(trimmed, "BGP.next_hop:") && cur.NextHop == 0:
+			if fields := strings.Fields(trimmed); len(fields) > 1 {
+				cur.NextHop, _ = FromDots(fields[1])
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		if cerr, ok := flush().(callbackError); ok {
+			err = cerr.err
+		}
+	}
+	return diags, err
+}
+
+// parseBIRDRoute parses the description after the prefix
+func parseBIRDRoute(prefix Prefix, desc string) *Route {
+	route := &Route{Prefix: prefix}
+	// protocol and flags are after the first "["
+	if pos := strings.IndexByte(desc, '['); pos != -1 {
+		parseBIRDNextHop(route, strings.Fields(desc[:pos]))
+		rest := desc[pos+1:]
+		if end := strings.IndexByte(rest, ']'); end != -1 {
+			if fields := strings.Fields(rest[:end]); len(fields) > 0 {
+				route.Protocol = fields[0]
+			}
+			rest = rest[end+1:]
+		}
+		for _, f := range strings.Fields(rest) {
+			switch {
+			case f == "*":
+				route.Best = true
+			case strings.HasPrefix(f, "[AS"):
+				asn := strings.TrimRight(f[3:], "ie?]")
+				if n, err := strconv.ParseUint(asn, 10, 32); err == nil {
+					route.ASN = uint32(n)
+				}
+			}
+		}
+	}
+	return route
+}
+
+// parseBIRDNextHop reads "via 192.0.2.1 on eth0" or "dev eth0"
+func parseBIRDNextHop(route *Route, fields []string) {
+	for i := 0; i+1 < len(fields); i++ {
+		switch fields[i] {
+		case "via":
+			route.NextHop, _ = FromDots(fields[i+1])
+		case "on", "dev":
+			route.Interface = fields[i+1]
+		}
+	}
+}
+
+// parseASPath reads space separated ASNs, flattening AS sets such as
+// "{64512 64513}"
+func parseASPath(fields []string) ([]uint32, error) {
+	var path []uint32
+	for _, f := range fields {
+		f = strings.Trim(f, "{}(),")
+		if f == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimPrefix(f, "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad AS path element %q", f)
+		}
+		path = append(path, uint32(n))
+	}
+	return path, nil
+}
+
+// ReadCiscoRoutes parses the output of "show ip route" from Cisco IOS or
+// Quagga/FRRouting, calling fn for each route:
+//
+//	B>* 1.0.0.0/24 [20/0] via 192.0.2.1, eth0, 01:02:03
+//	C>* 10.0.0.0/24 is directly connected, eth1
+//	O        10.2.0.0/16 [110/2] via 10.1.1.2, 00:01:02, GigabitEthernet0/0
+//	                     [110/2] via 10.1.1.3, 00:01:02, GigabitEthernet0/1
+//
+// Classful IOS output, where "10.0.0.0/24 is subnetted" gives the mask of
+// the lines below it, is understood.  Protocol is the route code, such
+// as "B" or "O E2", and Best is set for routes marked ">".  Lines that
+// look like routes but can not be parsed are returned as diagnostics.
+func ReadCiscoRoutes(r io.Reader, fn func(*Route) error) ([]*LineError, error) {
+	var last *Route
+	var subnetted Prefix
+	return readRouteLines(r, func(line int, text string) error {
+		fields := strings.Fields(strings.Replace(text, ",", " , ", -1))
+		if len(fields) == 0 {
+			return nil
+		}
+		isRoute := strings.Contains(text, " via ") || strings.Contains(text, "directly connected")
+
+		// the route codes are short words before the prefix
+		at := 0
+		for at < len(fields) && len(fields[at]) <= 3 && fields[at] != "via" &&
+			fields[at][0] != '[' && (fields[at][0] < '0' || fields[at][0] > '9') {
+			at++
+		}
+		var route *Route
+		switch {
+		case at < len(fields) && fields[at][0] >= '0' && fields[at][0] <= '9':
+			prefix, err := ParsePrefix(fields[at])
+			if err != nil {
+				if isRoute {
+					return err
+				}
+				return nil
+			}
+			rest := fields[at+1:]
+			if len(rest) > 1 && rest[0] == "is" && rest[1] == "subnetted" {
+				subnetted = prefix
+				return nil
+			}
+			if !isRoute {
+				return nil
+			}
+			if strings.IndexByte(fields[at], '/') == -1 {
+				// classful output leaves off the mask
+				cb := classfulBits(prefix.Addr)
+				if subnetted.Bits == 0 || Mask(prefix.Addr, cb) != Mask(subnetted.Addr, cb) {
+					return fmt.Errorf("no mask for %s", fields[at])
+				}
+				prefix = Prefix{Mask(prefix.Addr, subnetted.Bits), subnetted.Bits}
+			}
+			codes := strings.Join(fields[:at], " ")
+			route = &Route{
+				Prefix: prefix,
+				Best:   strings.IndexByte(codes, '>') != -1,
+				Protocol: strings.TrimSpace(strings.Map(func(r rune) rune {
+					if r == '>' || r == '*' {
+						return -1
+					}
+					return r
+				}, codes)),
+			}
+			fields = rest
+		case isRoute && last != nil && (text[0] == ' ' || text[0] == '\t'):
+			// another path for the previous prefix
+			route = &Route{Prefix: last.Prefix, Protocol: last.Protocol}
+		case isRoute:
+			return fmt.Errorf("no prefix in route %q", strings.TrimSpace(text))
+		default:
+			return nil
+		}
+
+		for i, f := range fields {
+			if f == "via" && i+1 < len(fields) {
+				nh, err := FromDots(fields[i+1])
+				if err != nil {
+					return fmt.Errorf("bad next hop %q", fields[i+1])
+				}
+				route.NextHop = nh
+				route.Interface = ciscoInterface(fields[i+2:])
+				break
+			}
+			if f == "connected" {
+				route.Interface = ciscoInterface(fields[i+1:])
+				break
+			}
+		}
+		last = route
+		if err := fn(route); err != nil {
+			return callbackError{&LineError{Line: line, Err: err}}
+		}
+		return nil
+	})
+}
+
+// classfulBits is the prefix length of an address's class A, B or C
+// network
+func classfulBits(addr uint32) byte {
+	switch {
+	case addr < 0x80000000:
+		return 8
+	case addr < 0xC0000000:
+		return 16
+	}
+	return 24
+}
+
+// ciscoInterface picks the interface out of the comma separated fields
+// after a next hop, skipping the route's age such as "00:01:02" or "1w2d"
+func ciscoInterface(fields []string) string {
+	for _, f := range fields {
+		if f == "," || strings.Trim(f, "0123456789:wdhmsy") == "" {
+			continue
+		}
+		return f
+	}
+	return ""
+}
+
+// MRT record types and subtypes of RFC 6396 and RFC 8050
+const (
+	mrtTableDumpV2        = 13
+	mrtPeerIndexTable     = 1
+	mrtRIBIPv4Unicast     = 2
+	mrtRIBIPv4Multicast   = 3
+	mrtRIBIPv4UnicastAP   = 8
+	mrtRIBIPv4MulticastAP = 9
+)
+
+// BGP path attributes
+const (
+	bgpAttrASPath    = 2
+	bgpAttrNextHop   = 3
+	bgpAttrExtLength = 0x10
+	bgpASSet         = 1
+	bgpASSequence    = 2
+)
+
+// ErrBadMRT is returned for malformed MRT data
+var ErrBadMRT = errors.New("invalid MRT data")
+
+// maxMRTRecord is the longest RIB record read, the length comes from
+// the data and is not trusted for an allocation
+const maxMRTRecord = 1 << 20
+
+// ReadMRT parses an MRT TABLE_DUMP_V2 RIB dump, as published by
+// RouteViews and RIPE RIS, calling fn for each RIB entry of the IPv4
+// unicast and multicast tables.  Each prefix usually has an entry per
+// peer.  Protocol is "bgp" and other record types are skipped.
+//
+// The dumps are usually compressed, r should be the decompressed stream.
+func ReadMRT(r io.Reader, fn func(*Route) error) error {
+	br := bufio.NewReader(r)
+	var header [12]byte
+	for {
+		if _, err := io.ReadFull(br, header[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("%v: %v", ErrBadMRT, err)
+		}
+		typ := binary.BigEndian.Uint16(header[4:])
+		subtype := binary.BigEndian.Uint16(header[6:])
+		length := binary.BigEndian.Uint32(header[8:])
+		if typ != mrtTableDumpV2 || (subtype != mrtRIBIPv4Unicast && subtype != mrtRIBIPv4Multicast &&
+			subtype != mrtRIBIPv4UnicastAP && subtype != mrtRIBIPv4MulticastAP) {
+			if _, err := br.Discard(int(length)); err != nil {
+				return fmt.Errorf("%v: %v", ErrBadMRT, err)
+			}
+			continue
+		}
+		if length > maxMRTRecord {
+			return fmt.Errorf("%v: record of %d bytes", ErrBadMRT, length)
+		}
+		body := make([]byte, length)
+		if _, err := io.ReadFull(br, body); err != nil {
+			return fmt.Errorf("%v: %v", ErrBadMRT, err)
+		}
+		addPath := subtype == mrtRIBIPv4UnicastAP || subtype == mrtRIBIPv4MulticastAP
+		if err := parseMRTRIB(body, addPath, fn); err != nil {
+			return err
+		}
+	}
+}
+
+// parseMRTRIB parses a RIB_IPV4_UNICAST record
+func parseMRTRIB(b []byte, addPath bool, fn func(*Route) error) error {
+	bad := func(what string) error {
+		return fmt.Errorf("%v: short %s", ErrBadMRT, what)
+	}
+	if len(b) < 5 {
+		return bad("RIB header")
+	}
+	bits := b[4]
+	n := int(bits+7) / 8
+	if bits > 32 || len(b) < 5+n+2 {
+		return bad("prefix")
+	}
+	var addr [4]byte
+	copy(addr[:], b[5:5+n])
+	prefix := Prefix{Mask(binary.BigEndian.Uint32(addr[:]), bits), bits}
+	count := int(binary.BigEndian.Uint16(b[5+n:]))
+	b = b[5+n+2:]
+
+	for i := 0; i < count; i++ {
+		// peer index, originated time and the optional path id
+		skip := 6
+		if addPath {
+			skip += 4
+		}
+		if len(b) < skip+2 {
+			return bad("RIB entry")
+		}
+		alen := int(binary.BigEndian.Uint16(b[skip:]))
+		b = b[skip+2:]
+		if len(b) < alen {
+			return bad("attributes")
+		}
+		route := &Route{Prefix: prefix, Protocol: "bgp"}
+		if err := parseBGPAttributes(b[:alen], route); err != nil {
+			return err
+		}
+		b = b[alen:]
+		if n := len(route.ASPath); n > 0 {
+			route.ASN = route.ASPath[n-1]
+		}
+		if err := fn(route); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseBGPAttributes reads the AS path and next hop.  AS paths in
+// TABLE_DUMP_V2 always use four byte ASNs.
+func parseBGPAttributes(b []byte, route *Route) error {
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return fmt.Errorf("%v: short attribute", ErrBadMRT)
+		}
+		flags, typ := b[0], b[1]
+		var alen, hlen int
+		if flags&bgpAttrExtLength != 0 {
+			if len(b) < 4 {
+				return fmt.Errorf("%v: short attribute", ErrBadMRT)
+			}
+			alen, hlen = int(binary.BigEndian.Uint16(b[2:])), 4
+		} else {
+			alen, hlen = int(b[2]), 3
+		}
+		if len(b) < hlen+alen {
+			return fmt.Errorf("%v: short attribute", ErrBadMRT)
+		}
+		val := b[hlen : hlen+alen]
+		b = b[hlen+alen:]
+		switch typ {
+		case bgpAttrNextHop:
+			if len(val) == 4 {
+				route.NextHop = binary.BigEndian.Uint32(val)
+			}
+		case bgpAttrASPath:
+			for len(val) > 0 {
+				if len(val) < 2 || len(val) < 2+4*int(val[1]) {
+					return fmt.Errorf("%v: short AS path", ErrBadMRT)
+				}
+				segType, n := val[0], int(val[1])
+				if segType == bgpASSequence || segType == bgpASSet {
+					for j := 0; j < n; j++ {
+						route.ASPath = append(route.ASPath, binary.BigEndian.Uint32(val[2+4*j:]))
+					}
+				}
+				val = val[2+4*n:]
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package ipv4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// routeString renders the fields of a route checked by the tests
+func routeString(r *Route) string {
+	s := fmt.Sprintf("%s %s", r, r.Protocol)
+	if r.Best {
+		s += " best"
+	}
+	if len(r.ASPath) > 0 {
+		s += fmt.Sprint(" ", r.ASPath)
+	}
+	return s
+}
+
+// readFixture runs a text route reader over a file in testdata
+func readFixture(t *testing.T, name string, read func(r *os.File, fn func(*Route) error) ([]*LineError, error)) ([]string, []string) {
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("Open failed: %s", err)
+	}
+	defer f.Close()
+	var routes, diags []string
+	lerrs, err := read(f, func(r *Route) error {
+		routes = append(routes, routeString(r))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%s: %s", name, err)
+	}
+	for _, d := range lerrs {
+		diags = append(diags, d.Error())
+	}
+	return routes, diags
+}
+
+func readBIRD(f *os.File, fn func(*Route) error) ([]*LineError, error) {
+	return ReadBIRDRoutes(f, fn)
+}
+
+func readCisco(f *os.File, fn func(*Route) error) ([]*LineError, error) {
+	return ReadCiscoRoutes(f, fn)
+}
+
+func TestReadBIRDRoutes(t *testing.T) {
+	cases := []struct {
+		name   string
+		routes []string
+		diags  []string
+	}{
+		{
+			"bird1.txt",
+			[]string{
+				"0.0.0.0/0 via 192.0.2.1 dev eth0 kernel1 best",
+				"1.0.0.0/24 via 192.0.2.1 dev eth0 AS13335 bgp_he best",
+				"1.0.0.0/24 via 192.0.2.9 dev eth1 AS13335 bgp_ntt",
+				"1.0.4.0/22 via 192.0.2.9 dev eth1 AS38803 bgp_ntt best",
+				"10.0.0.0/8 dev eth2 direct1 best",
+				"10.1.0.0/16 static1 best",
+			},
+			[]string{"line 10: Bad IP address"},
+		},
+		{
+			"bird2.txt",
+			[]string{
+				"1.0.0.0/24 via 192.0.2.1 dev eth0 AS13335 bgp_he best [6939 13335]",
+				"1.0.0.0/24 via 192.0.2.9 dev eth1 AS13335 bgp_ntt [2914 64512 13335]",
+				"1.0.4.0/22 via 192.0.2.9 dev eth1 AS38803 bgp_ntt best [2914 4826 38803]",
+				"1.1.1.0/24 via 192.0.2.1 dev eth0 AS13335 bgp_he best",
+				"10.0.0.0/8 dev eth2 direct1 best",
+			},
+			[]string{`line 22: bad AS path element "bogus"`},
+		},
+	}
+	for _, c := range cases {
+		routes, diags := readFixture(t, c.name, readBIRD)
+		if !reflect.DeepEqual(routes, c.routes) {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, strings.Join(routes, "\n"), strings.Join(c.routes, "\n"))
+		}
+		if !reflect.DeepEqual(diags, c.diags) {
+			t.Errorf("%s: diagnostics %q, want %q", c.name, diags, c.diags)
+		}
+	}
+}
+
+func TestReadCiscoRoutes(t *testing.T) {
+	cases := []struct {
+		name   string
+		routes []string
+		diags  []string
+	}{
+		{
+			"quagga.txt",
+			[]string{
+				"0.0.0.0/0 via 192.168.1.1 dev eth0 K best",
+				"1.0.0.0/24 via 192.0.2.1 dev eth0 B best",
+				"1.0.0.0/24 via 192.0.2.9 dev eth1 B",
+				"1.0.0.0/24 via 192.0.2.5 dev eth0 B",
+				"10.1.0.0/16 via 10.0.0.2 dev eth1 O",
+				"10.0.0.0/24 dev eth1 C best",
+			},
+			[]string{`line 11: bad next hop "192.0.2.300"`},
+		},
+		{
+			"cisco.txt",
+			[]string{
+				"0.0.0.0/0 via 192.0.2.1 S",
+				"10.1.1.0/24 dev GigabitEthernet0/0 C",
+				"10.1.1.1/32 dev GigabitEthernet0/0 L",
+				"10.2.0.0/16 via 10.1.1.2 dev GigabitEthernet0/0 O",
+				"10.2.0.0/16 via 10.1.1.3 dev GigabitEthernet0/1 O",
+				"172.16.0.0/16 via 10.1.1.2 dev GigabitEthernet0/0 O E2",
+				"172.20.1.0/24 dev Ethernet0 C",
+				"172.20.2.0/24 via 172.20.1.2 dev Ethernet0 D",
+			},
+			nil,
+		},
+	}
+	for _, c := range cases {
+		routes, diags := readFixture(t, c.name, readCisco)
+		if !reflect.DeepEqual(routes, c.routes) {
+			t.Errorf("%s: got\n%s\nwant\n%s", c.name, strings.Join(routes, "\n"), strings.Join(c.routes, "\n"))
+		}
+		if !reflect.DeepEqual(diags, c.diags) {
+			t.Errorf("%s: diagnostics %q, want %q", c.name, diags, c.diags)
+		}
+	}
+
+	// a classful subnet without its header
+	_, err := ReadCiscoRoutes(strings.NewReader("C       172.20.1.0 is directly connected, Ethernet0\n"),
+		func(*Route) error { return nil })
+	if err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+	diags, _ := ReadCiscoRoutes(strings.NewReader("C       172.20.1.0 is directly connected, Ethernet0\n"+
+		"             via 1.2.3.4\n"), func(*Route) error { return nil })
+	if len(diags) != 2 {
+		t.Errorf("diagnostics %v, want 2", diags)
+	}
+}
+
+func TestReadMRT(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/rib.mrt")
+	if err != nil {
+		t.Fatalf("ReadFile failed: %s", err)
+	}
+	var routes []string
+	err = ReadMRT(bytes.NewReader(data), func(r *Route) error {
+		routes = append(routes, routeString(r))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadMRT failed: %s", err)
+	}
+	want := []string{
+		"1.0.0.0/24 via 192.0.2.1 AS13335 bgp [6939 13335]",
+		"1.0.0.0/24 via 192.0.2.9 AS13335 bgp [2914 64512 13335]",
+		"1.0.4.0/22 via 192.0.2.9 AS4200000000 bgp [2914 4826 4200000000]",
+		"0.0.0.0/0 via 192.0.2.1 bgp",
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(routes, "\n"), strings.Join(want, "\n"))
+	}
+
+	// truncation is an error unless it is between records
+	boundaries := make(map[int]bool)
+	for i := 0; i < len(data); i += 12 + int(binary.BigEndian.Uint32(data[i+8:])) {
+		boundaries[i] = true
+	}
+	for i := 1; i < len(data); i++ {
+		err := ReadMRT(bytes.NewReader(data[:i]), func(*Route) error { return nil })
+		if (err == nil) != boundaries[i] {
+			t.Errorf("error %v reading %d of %d bytes", err, i, len(data))
+		}
+	}
+}
+
+func TestReadMRTOversized(t *testing.T) {
+	for _, length := range []uint32{maxMRTRecord + 1, 0xFFFFFFFF} {
+		header := make([]byte, 12)
+		binary.BigEndian.PutUint16(header[4:], mrtTableDumpV2)
+		binary.BigEndian.PutUint16(header[6:], mrtRIBIPv4Unicast)
+		binary.BigEndian.PutUint32(header[8:], length)
+		err := ReadMRT(bytes.NewReader(header), func(*Route) error { return nil })
+		if err == nil || !strings.Contains(err.Error(), "record of") {
+			t.Errorf("length %d: expected record size error, got %v", length, err)
+		}
+	}
+}
+
+func TestInsertRoute(t *testing.T) {
+	f, _ := os.Open("testdata/bird1.txt")
+	defer f.Close()
+	tab := NewPrefixTable()
+	if _, err := ReadBIRDRoutes(f, tab.InsertRoute); err != nil {
+		t.Fatalf("ReadBIRDRoutes failed: %s", err)
+	}
+	if tab.Len() != 5 {
+		t.Errorf("Len = %d, want 5", tab.Len())
+	}
+	_, v, ok := tab.LongestMatch(0x01000001)
+	if r, _ := v.(*Route); !ok || r == nil || r.Protocol != "bgp_he" {
+		t.Errorf("LongestMatch = %v", v)
+	}
+
+	// a later best route replaces the first, nothing replaces a best one
+	tab = NewPrefixTable()
+	p := mustPrefix("10.0.0.0/8")
+	tab.InsertRoute(&Route{Prefix: p, Protocol: "a"})
+	tab.InsertRoute(&Route{Prefix: p, Protocol: "b"})
+	tab.InsertRoute(&Route{Prefix: p, Protocol: "c", Best: true})
+	tab.InsertRoute(&Route{Prefix: p, Protocol: "d", Best: true})
+	if v, _ := tab.Get(p); v.(*Route).Protocol != "c" {
+		t.Errorf("kept %v, want c", v)
+	}
+}
+
+func TestRouteCallbackError(t *testing.T) {
+	stop := errors.New("stop")
+	count := 0
+	fn := func(*Route) error {
+		count++
+		return stop
+	}
+	for _, name := range []string{"bird1.txt", "bird2.txt", "quagga.txt"} {
+		f, _ := os.Open("testdata/" + name)
+		count = 0
+		var err error
+		if strings.HasPrefix(name, "bird") {
+			_, err = ReadBIRDRoutes(f, fn)
+		} else {
+			_, err = ReadCiscoRoutes(f, fn)
+		}
+		f.Close()
+		if lerr, ok := err.(*LineError); !ok || lerr.Err != stop || count != 1 {
+			t.Errorf("%s: error %v after %d routes", name, err, count)
+		}
+	}
+	data, _ := ioutil.ReadFile("testdata/rib.mrt")
+	if err := ReadMRT(bytes.NewReader(data), fn); err != stop {
+		t.Errorf("ReadMRT error %v", err)
+	}
+
+	// the last route of a BIRD dump is sent at the end of input
+	_, err := ReadBIRDRoutes(strings.NewReader("10.0.0.0/8 dev eth0 [direct1 2020-01-01] * (240)\n"), fn)
+	if lerr, ok := err.(*LineError); !ok || lerr.Line != 1 {
+		t.Errorf("error %v", err)
+	}
+}
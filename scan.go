@@ -0,0 +1,79 @@
+package ipv4
+
+// DotsScanner finds dotted IPv4 addresses in a byte buffer without
+// allocating.  A token is a run of digits and dots, ignoring a leading
+// or trailing dot, that parses with FromDotsBytes.
+//
+//	var s ipv4.DotsScanner
+//	s.Reset(line)
+//	for s.Scan() {
+//		addr := s.Addr()
+//		...
+//	}
+type DotsScanner struct {
+	buf   []byte
+	pos   int
+	addr  uint32
+	start int
+	end   int
+}
+
+// Reset starts scanning a new buffer
+func (s *DotsScanner) Reset(buf []byte) {
+	*s = DotsScanner{buf: buf}
+}
+
+// Scan advances to the next address, returning false at the end of the
+// buffer
+func (s *DotsScanner) Scan() bool {
+	buf := s.buf
+	for s.pos < len(buf) {
+		// skip to the start of a run
+		for s.pos < len(buf) && !isDigitOrDot(buf[s.pos]) {
+			s.pos++
+		}
+		start := s.pos
+		for s.pos < len(buf) && isDigitOrDot(buf[s.pos]) {
+			s.pos++
+		}
+		end := s.pos
+
+		// "at 1.2.3.4." or "...1.2.3.4"
+		for start < end && buf[start] == '.' {
+			start++
+		}
+		for end > start && buf[end-1] == '.' {
+			end--
+		}
+		if end-start < len("0.0.0.0") || end-start > len("255.255.255.255") {
+			continue
+		}
+		addr, err := FromDotsBytes(buf[start:end])
+		if err != nil {
+			continue
+		}
+		s.addr, s.start, s.end = addr, start, end
+		return true
+	}
+	return false
+}
+
+// Addr returns the address found by the last call to Scan
+func (s *DotsScanner) Addr() uint32 {
+	return s.addr
+}
+
+// Offset returns the position of the last address in the buffer
+func (s *DotsScanner) Offset() int {
+	return s.start
+}
+
+// Bytes returns the text of the last address.  It points into the
+// buffer passed to Reset.
+func (s *DotsScanner) Bytes() []byte {
+	return s.buf[s.start:s.end]
+}
+
+func isDigitOrDot(b byte) bool {
+	return (b >= '0' && b <= '9') || b == '.'
+}
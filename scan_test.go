@@ -0,0 +1,117 @@
+package ipv4
+
+import (
+	"testing"
+)
+
+func TestDotsScanner(t *testing.T) {
+	line := []byte(`10.0.0.1 - - [10/Oct/2020:13:55:36] "GET / HTTP/1.1" 200 2326 "1.2.3.4, 999.1.1.1, 5.6.7.8." 1.2.3.4.5 ...9.9.9.9`)
+	want := []struct {
+		dots   string
+		offset int
+	}{
+		{"10.0.0.1", 0},
+		{"1.2.3.4", 63},
+		{"5.6.7.8", 83},
+		{"9.9.9.9", 106},
+	}
+	var s DotsScanner
+	s.Reset(line)
+	for i, w := range want {
+		if !s.Scan() {
+			t.Fatalf("Scan %d returned false", i)
+		}
+		if ToDots(s.Addr()) != w.dots || s.Offset() != w.offset || string(s.Bytes()) != w.dots {
+			t.Errorf("Scan %d = %s at %d (%q), want %s at %d", i,
+				ToDots(s.Addr()), s.Offset(), s.Bytes(), w.dots, w.offset)
+		}
+	}
+	if s.Scan() {
+		t.Errorf("Unexpected extra address %s", ToDots(s.Addr()))
+	}
+
+	s.Reset(nil)
+	if s.Scan() {
+		t.Errorf("Scan of empty buffer returned true")
+	}
+}
+
+func TestFromDotsBytes(t *testing.T) {
+	for _, c := range []string{"0.0.0.0", "1.19.159.255", "255.255.255.255"} {
+		want, _ := FromDots(c)
+		got, err := FromDotsBytes([]byte(c))
+		if err != nil || got != want {
+			t.Errorf("FromDotsBytes(%q) = %d, %v", c, got, err)
+		}
+	}
+	for _, c := range []string{"", "0.0.0", "0.0.0.0.", "1..1.1", "256.1.1.1", "1.1.1.a"} {
+		if _, err := FromDotsBytes([]byte(c)); err == nil {
+			t.Errorf("FromDotsBytes(%q) did not error", c)
+		}
+	}
+}
+
+func TestAppendDots(t *testing.T) {
+	buf := []byte("ip=")
+	buf = AppendDots(buf, 0x01139FFF)
+	if string(buf) != "ip=1.19.159.255" {
+		t.Errorf("AppendDots = %q", buf)
+	}
+
+	buf = make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendDots(buf[:0], 0xFFFFFFFF)
+	})
+	if allocs != 0 {
+		t.Errorf("AppendDots allocated %f times", allocs)
+	}
+}
+
+func TestZeroAllocs(t *testing.T) {
+	line := []byte("from 192.168.1.1 to 10.0.0.1")
+	var s DotsScanner
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Reset(line)
+		for s.Scan() {
+			tempUint32 = s.Addr()
+		}
+		tempUint32, _ = FromDotsBytes(line[5:16])
+	})
+	if allocs != 0 {
+		t.Errorf("Scanning allocated %f times", allocs)
+	}
+}
+
+var tempBytes []byte
+
+func BenchmarkAppendDots(b *testing.B) {
+	b.ReportAllocs()
+	buf := make([]byte, 0, 16)
+	ip, _ := FromDots("1.19.159.255")
+	for i := 0; i < b.N; i++ {
+		buf = AppendDots(buf[:0], ip)
+	}
+	tempBytes = buf
+}
+
+func BenchmarkFromDotsBytes(b *testing.B) {
+	b.ReportAllocs()
+	var val uint32
+	in := []byte("255.129.128.127")
+	for i := 0; i < b.N; i++ {
+		val, _ = FromDotsBytes(in)
+	}
+	tempOut = val
+}
+
+func BenchmarkDotsScanner(b *testing.B) {
+	b.ReportAllocs()
+	line := []byte(`10.0.0.1 - - [10/Oct/2020:13:55:36 -0700] "GET /index.html HTTP/1.1" 200 2326 "-" "Mozilla/5.0" "203.0.113.9, 198.51.100.7"`)
+	var s DotsScanner
+	for i := 0; i < b.N; i++ {
+		s.Reset(line)
+		for s.Scan() {
+			tempUint32 = s.Addr()
+		}
+	}
+}
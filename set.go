@@ -47,6 +47,11 @@ func (m *Set) Add(ipv4dots string) bool {
 	if err != nil {
 		return false
 	}
+	return m.add(x)
+}
+
+// add inserts an address, keeping the set sorted
+func (m *Set) add(x uint32) bool {
 	orig := *m
 	i := sort.Search(len(orig), func(i int) bool { return orig[i] >= x })
 	if i == len(orig) {
@@ -69,17 +74,50 @@ func (m *Set) Add(ipv4dots string) bool {
 	return true
 }
 
-// AddAll adds many IPv4 at once
+// maxSetExpansion is the most addresses AddAll expands specs into in one
+// call, a "0.0.0.0/0" would otherwise need 16 GB
+const maxSetExpansion = 1 << 20
+
+// AddAll adds many IPv4 at once.  Besides dotted addresses, any spec
+// understood by ParseRangeSpec (CIDRs, ranges, wildcards) is expanded
+// into its individual addresses, up to maxSetExpansion addresses in
+// total.  It returns false if an entry was skipped, because it could not
+// be parsed or would go over the limit.
 func (m *Set) AddAll(ipv4dots []string) bool {
 	in := *m
+	ok := true
+	budget := uint64(maxSetExpansion)
 	for _, val := range ipv4dots {
 		if bval, err := FromDots(val); err == nil {
 			in = append(in, bval)
+			continue
+		}
+		ranges, err := ParseRangeSpec(val, RangeStrict)
+		if err != nil {
+			ok = false
+			continue
+		}
+		size := uint64(0)
+		for _, r := range ranges {
+			size += uint64(r.Right) - uint64(r.Left) + 1
+		}
+		if size > budget {
+			ok = false
+			continue
+		}
+		budget -= size
+		for _, r := range ranges {
+			for x := r.Left; ; x++ {
+				in = append(in, x)
+				if x == r.Right {
+					break
+				}
+			}
 		}
 	}
 	*m = in
 	m.sort()
-	return true
+	return ok
 }
 
 // Valid return true if the internal storage is in sorted form and unique
@@ -108,6 +146,9 @@ func (m Set) ToDots() []string {
 
 func (m *Set) sort() {
 	in := *m
+	if len(in) == 0 {
+		return
+	}
 	sort.Sort(in)
 
 	// inplace de-dup, uniqueness
@@ -123,5 +164,5 @@ func (m *Set) sort() {
 		// only set what is required
 		in[j] = in[i]
 	}
-	in = in[:j+1]
+	*m = in[:j+1]
 }
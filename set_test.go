@@ -85,6 +85,19 @@ func TestAdd(t *testing.T) {
 	}
 }
 
+func TestSortDedup(t *testing.T) {
+	s := Set{3, 1, 2, 3, 1}
+	s.sort()
+	if len(s) != 3 || s[0] != 1 || s[1] != 2 || s[2] != 3 {
+		t.Errorf("Expected [1 2 3], got %v", s)
+	}
+	empty := Set{}
+	empty.sort()
+	if len(empty) != 0 {
+		t.Errorf("Expected empty set, got %v", empty)
+	}
+}
+
 func TestAddAll(t *testing.T) {
 	s := NewSet(2)
 	s.AddAll([]string{"127.0.0.1", "10.0.0.1"})
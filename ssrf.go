@@ -0,0 +1,128 @@
+package ipv4
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// BlockedAddressError is returned when a destination is not allowed
+type BlockedAddressError struct {
+	Addr   string
+	Reason string
+}
+
+func (e *BlockedAddressError) Error() string {
+	return fmt.Sprintf("connection to %s blocked: %s", e.Addr, e.Reason)
+}
+
+// SSRFGuard refuses connections to internal destinations: loopback,
+// private, link local, carrier grade NAT, cloud metadata and every other
+// non-global block (see SpecialPurpose).
+//
+// The check runs in the dialer on the resolved address, after DNS, so a
+// hostname that re-resolves to an internal address (DNS rebinding) is
+// still refused.  IPv6 destinations, other than IPv4-mapped ones, are
+// refused as well.
+type SSRFGuard struct {
+	// Allow lists exceptions.  Addresses with a non-nil value in the map
+	// may be connected to even if they are internal.
+	Allow *IntervalMap
+}
+
+// Check returns a *BlockedAddressError if the address is not allowed
+func (g *SSRFGuard) Check(ip net.IP) error {
+	addr, err := FromNetIP(ip)
+	if err != nil {
+		return &BlockedAddressError{Addr: ip.String(), Reason: "not an IPv4 address"}
+	}
+	dots := ToDots(addr)
+	if g.Allow != nil && g.Allow.Contains(dots) != nil {
+		return nil
+	}
+	if name, special := SpecialPurpose(addr); special {
+		return &BlockedAddressError{Addr: dots, Reason: name}
+	}
+	if IsPrivate(dots) {
+		return &BlockedAddressError{Addr: dots, Reason: "private"}
+	}
+	return nil
+}
+
+// Control is a net.Dialer Control hook that checks the address being
+// connected to
+func (g *SSRFGuard) Control(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return &BlockedAddressError{Addr: host, Reason: "not an IP address"}
+	}
+	return g.Check(ip)
+}
+
+// Dialer returns a net.Dialer with the guard installed
+func (g *SSRFGuard) Dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   g.Control,
+	}
+}
+
+// Transport returns an http.Transport, with the settings of
+// http.DefaultTransport, that only connects to allowed addresses.  It
+// does not use a proxy from the environment since the guard would then
+// only check the proxy's address.
+func (g *SSRFGuard) Transport() *http.Transport {
+	return &http.Transport{
+		DialContext:           g.Dialer().DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// ValidateURL checks an http or https URL before use, resolving the host
+// and checking every address it resolves to.  Numeric hosts in legacy
+// notation, such as "0x7f.1", are checked as libc would read them.
+//
+// This gives an early error for user supplied URLs but can not stop DNS
+// rebinding, the URL must still be fetched with the guard's Transport.
+func (g *SSRFGuard) ValidateURL(ctx context.Context, rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("URL %q has no host", rawurl)
+	}
+	if addr, _, err := ParseLegacy(host); err == nil {
+		return g.Check(ToNetIP(addr))
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return g.Check(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err := g.Check(addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
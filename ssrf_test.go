@@ -0,0 +1,114 @@
+package ipv4
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSSRFGuardCheck(t *testing.T) {
+	allow := NewIntervalMap(1)
+	if err := allow.Add("10.1.2.0/24", true); err != nil {
+		t.Fatal(err)
+	}
+	g := SSRFGuard{Allow: allow}
+	tests := []struct {
+		ip      string
+		blocked bool
+	}{
+		{"8.8.8.8", false},
+		{"10.1.2.3", false},
+		{"10.1.3.3", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"224.0.0.1", true},
+		{"::ffff:127.0.0.1", true},
+		{"::ffff:8.8.8.8", false},
+		{"::1", true},
+		{"2001:4860:4860::8888", true},
+	}
+	for _, tt := range tests {
+		err := g.Check(net.ParseIP(tt.ip))
+		if (err != nil) != tt.blocked {
+			t.Errorf("Check(%s) = %v, want blocked %t", tt.ip, err, tt.blocked)
+		}
+		if err != nil {
+			if _, ok := err.(*BlockedAddressError); !ok {
+				t.Errorf("Check(%s) error is %T", tt.ip, err)
+			}
+		}
+	}
+}
+
+func TestSSRFGuardTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	g := &SSRFGuard{}
+	client := &http.Client{Transport: g.Transport()}
+	_, err := client.Get(srv.URL)
+	if err == nil {
+		t.Fatalf("Expected request to loopback to be blocked")
+	}
+
+	// the exception lets the same request through
+	g.Allow = NewIntervalMap(1)
+	if err := g.Allow.Add("127.0.0.1", true); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected allowed request to succeed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Got status %d", resp.StatusCode)
+	}
+}
+
+func TestSSRFGuardDialer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	g := &SSRFGuard{}
+	conn, err := g.Dialer().Dial("tcp", ln.Addr().String())
+	if err == nil {
+		conn.Close()
+		t.Fatalf("Expected dial to loopback to be blocked")
+	}
+}
+
+func TestSSRFGuardValidateURL(t *testing.T) {
+	g := &SSRFGuard{}
+	ctx := context.Background()
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"http://8.8.8.8/", false},
+		{"https://1.1.1.1:8443/path", false},
+		{"http://127.0.0.1/", true},
+		{"http://0x7f.1/", true},
+		{"http://2130706433/", true},
+		{"http://0251.0376.0251.0376/latest/meta-data/", true},
+		{"http://[::1]/", true},
+		{"http://localhost/", true},
+		{"ftp://8.8.8.8/", true},
+		{"http:///nohost", true},
+		{"://bad", true},
+	}
+	for _, tt := range tests {
+		err := g.ValidateURL(ctx, tt.url)
+		if (err != nil) != tt.blocked {
+			t.Errorf("ValidateURL(%q) = %v, want blocked %t", tt.url, err, tt.blocked)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package ipv4
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TTLInterval is an interval of a TTLMap with its expiry
+type TTLInterval struct {
+	Left    uint32
+	Right   uint32
+	Value   interface{}
+	Expires time.Time
+}
+
+// TTLMap is an interval map whose entries expire, such as a list of
+// temporary bans.  Lookups ignore expired entries, which stay in memory
+// until Sweep removes them.
+//
+// Where entries overlap the one that expires later wins, so banning
+// 1.2.3.4 for an hour inside a 15 minute ban of 1.2.3.0/24 keeps the
+// hour for that address.  On equal expiry the newer entry wins.
+//
+// A TTLMap is safe for concurrent use.
+type TTLMap struct {
+	// Clock is used for expiry, the system clock if nil
+	Clock Clock
+
+	mu        sync.RWMutex
+	intervals []TTLInterval // sorted and disjoint
+}
+
+// NewTTLMap creates an empty TTLMap
+func NewTTLMap() *TTLMap {
+	return &TTLMap{}
+}
+
+func (m *TTLMap) now() time.Time {
+	if m.Clock == nil {
+		return time.Now()
+	}
+	return m.Clock.Now()
+}
+
+// Add adds an address, CIDR or range (see ParseRangeSpec) that expires
+// after ttl
+func (m *TTLMap) Add(spec string, value interface{}, ttl time.Duration) error {
+	ranges, err := ParseRangeSpec(spec, RangeLenient)
+	if err != nil {
+		return err
+	}
+	expires := m.now().Add(ttl)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range ranges {
+		m.add(r.Left, r.Right, value, expires)
+	}
+	return nil
+}
+
+// AddRange adds the range [left, right] that expires at the given time
+func (m *TTLMap) AddRange(left, right uint32, value interface{}, expires time.Time) error {
+	if left > right {
+		return fmt.Errorf("left %s > right %s", ToDots(left), ToDots(right))
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(left, right, value, expires)
+	return nil
+}
+
+// add splices a new interval into the list, keeping the parts of
+// existing intervals that outlive it
+func (m *TTLMap) add(left, right uint32, value interface{}, expires time.Time) {
+	in := m.intervals
+	i := sort.Search(len(in), func(i int) bool {
+		return in[i].Right >= left
+	})
+	out := make([]TTLInterval, i, len(in)+3)
+	copy(out, in[:i])
+
+	// next is the first address of the new interval not yet emitted
+	next := uint64(left)
+	var tail *TTLInterval
+	j := i
+	for ; j < len(in) && in[j].Left <= right; j++ {
+		iv := in[j]
+		if iv.Left < left {
+			head := iv
+			head.Right = left - 1
+			out = appendTTL(out, head)
+		}
+		if iv.Right > right {
+			t := iv
+			t.Left = right + 1
+			tail = &t
+		}
+		if !iv.Expires.After(expires) {
+			continue
+		}
+		lo, hi := iv.Left, iv.Right
+		if lo < left {
+			lo = left
+		}
+		if hi > right {
+			hi = right
+		}
+		if next < uint64(lo) {
+			out = appendTTL(out, TTLInterval{uint32(next), lo - 1, value, expires})
+		}
+		iv.Left, iv.Right = lo, hi
+		out = appendTTL(out, iv)
+		next = uint64(hi) + 1
+	}
+	if next <= uint64(right) {
+		out = appendTTL(out, TTLInterval{uint32(next), right, value, expires})
+	}
+	if tail != nil {
+		out = appendTTL(out, *tail)
+	}
+	if j < len(in) {
+		out = appendTTL(out, in[j])
+		out = append(out, in[j+1:]...)
+	}
+	m.intervals = out
+}
+
+// appendTTL appends an interval, merging it into the last one if they
+// are adjacent with the same value and expiry
+func appendTTL(out []TTLInterval, iv TTLInterval) []TTLInterval {
+	if n := len(out); n > 0 && out[n-1].Right+1 == iv.Left &&
+		out[n-1].Expires.Equal(iv.Expires) && sameValue(out[n-1].Value, iv.Value) {
+		out[n-1].Right = iv.Right
+		return out
+	}
+	return append(out, iv)
+}
+
+// Remove deletes an address, CIDR or range whether or not it has expired
+func (m *TTLMap) Remove(spec string) error {
+	ranges, err := ParseRangeSpec(spec, RangeLenient)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range ranges {
+		m.remove(r.Left, r.Right)
+	}
+	return nil
+}
+
+func (m *TTLMap) remove(left, right uint32) {
+	out := make([]TTLInterval, 0, len(m.intervals)+1)
+	for _, iv := range m.intervals {
+		if iv.Right < left || iv.Left > right {
+			out = append(out, iv)
+			continue
+		}
+		if iv.Left < left {
+			head := iv
+			head.Right = left - 1
+			out = append(out, head)
+		}
+		if iv.Right > right {
+			tail := iv
+			tail.Left = right + 1
+			out = append(out, tail)
+		}
+	}
+	m.intervals = out
+}
+
+// Lookup returns the live entry containing addr
+func (m *TTLMap) Lookup(addr uint32) (interface{}, time.Time, bool) {
+	now := m.now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	in := m.intervals
+	i := sort.Search(len(in), func(i int) bool {
+		return in[i].Right >= addr
+	})
+	if i == len(in) || in[i].Left > addr || !in[i].Expires.After(now) {
+		return nil, time.Time{}, false
+	}
+	return in[i].Value, in[i].Expires, true
+}
+
+// Contains returns the value of the live entry containing an address,
+// or nil
+func (m *TTLMap) Contains(dots string) interface{} {
+	addr, err := FromDots(dots)
+	if err != nil {
+		return nil
+	}
+	val, _, _ := m.Lookup(addr)
+	return val
+}
+
+// Len returns the number of intervals, including expired ones not yet
+// swept
+func (m *TTLMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.intervals)
+}
+
+// Sweep removes expired entries, returning the number of intervals
+// removed
+func (m *TTLMap) Sweep() int {
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sweep(now)
+}
+
+func (m *TTLMap) sweep(now time.Time) int {
+	in := m.intervals
+	out := in[:0]
+	for _, iv := range in {
+		if !iv.Expires.After(now) {
+			continue
+		}
+		out = appendTTL(out, iv)
+	}
+	for i := len(out); i < len(in); i++ {
+		in[i] = TTLInterval{}
+	}
+	m.intervals = out
+	return len(in) - len(out)
+}
+
+// StartSweeper calls Sweep every interval, on the system clock, until
+// the returned stop function is called
+func (m *TTLMap) StartSweeper(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				m.Sweep()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(done)
+		})
+	}
+}
+
+// Intervals returns a copy of the live entries
+func (m *TTLMap) Intervals() []TTLInterval {
+	now := m.now()
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]TTLInterval, 0, len(m.intervals))
+	for _, iv := range m.intervals {
+		if iv.Expires.After(now) {
+			out = append(out, iv)
+		}
+	}
+	return out
+}
+
+// WriteMMDB snapshots the live entries as a MaxMind DB.  Each record is a
+// map with the entry's "value" and its "expires" time in Unix seconds, so
+// the value must be a type MMDBWriter supports.
+func (m *TTLMap) WriteMMDB(out io.Writer, mw MMDBWriter) error {
+	snap := NewIntervalMap(0)
+	for _, iv := range m.Intervals() {
+		rec := map[string]interface{}{
+			"value":   iv.Value,
+			"expires": uint64(iv.Expires.Unix()),
+		}
+		if err := snap.insert(iv.Left, iv.Right, rec); err != nil {
+			return err
+		}
+	}
+	return mw.Write(out, snap)
+}
+
+// LoadMMDB adds the entries of a snapshot written by WriteMMDB, skipping
+// those that have since expired
+func (m *TTLMap) LoadMMDB(db *MMDB) error {
+	snap, err := db.IntervalMap("")
+	if err != nil {
+		return err
+	}
+	now := m.now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, iv := range snap.Intervals {
+		rec, ok := iv.Value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%v: snapshot record is not a map", ErrBadMMDB)
+		}
+		secs, ok := rec["expires"].(uint64)
+		if !ok {
+			return fmt.Errorf("%v: snapshot record has no expiry", ErrBadMMDB)
+		}
+		expires := time.Unix(int64(secs), 0)
+		if expires.After(now) {
+			m.add(iv.Left, iv.Right, rec["value"], expires)
+		}
+	}
+	return nil
+}
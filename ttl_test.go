@@ -0,0 +1,202 @@
+package ipv4
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ttlString renders the intervals of a TTLMap with expiries relative to
+// the clock, for comparison in tests
+func ttlString(m *TTLMap, clock *fakeClock) []string {
+	var out []string
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, iv := range m.intervals {
+		out = append(out, Interval{iv.Left, iv.Right, iv.Value}.String()+" "+iv.Expires.Sub(clock.Now()).String())
+	}
+	return out
+}
+
+func TestTTLMapOverlap(t *testing.T) {
+	clock := newFakeClock()
+	m := NewTTLMap()
+	m.Clock = clock
+
+	if err := m.Add("1.2.3.0/24", "net", 15*time.Minute); err != nil {
+		t.Fatalf("Add failed: %s", err)
+	}
+	m.Add("1.2.3.4", "host", time.Hour)
+	m.Add("1.2.3.10-1.2.3.20", "short", time.Minute)
+	m.Add("1.2.3.250-1.2.4.5", "edge", 15*time.Minute)
+
+	want := []string{
+		"[1.2.3.0, 1.2.3.3]=net 15m0s",
+		"[1.2.3.4, 1.2.3.4]=host 1h0m0s",
+		"[1.2.3.5, 1.2.3.249]=net 15m0s",
+		"[1.2.3.250, 1.2.4.5]=edge 15m0s",
+	}
+	if got := ttlString(m, clock); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	cases := []struct {
+		dots string
+		want interface{}
+	}{
+		{"1.2.3.4", "host"},
+		{"1.2.3.15", "net"},
+		{"1.2.3.255", "edge"},
+		{"1.2.4.5", "edge"},
+		{"1.2.4.6", nil},
+		{"junk", nil},
+	}
+	for _, c := range cases {
+		if got := m.Contains(c.dots); got != c.want {
+			t.Errorf("Contains(%s) = %v, want %v", c.dots, got, c.want)
+		}
+	}
+
+	// after 15 minutes only the host ban is live
+	clock.Advance(15 * time.Minute)
+	if got := m.Contains("1.2.3.15"); got != nil {
+		t.Errorf("expired entry still matched: %v", got)
+	}
+	val, expires, ok := m.Lookup(0x01020304)
+	if !ok || val != "host" || expires.Sub(clock.Now()) != 45*time.Minute {
+		t.Errorf("Lookup = %v, %v, %v", val, expires, ok)
+	}
+	if m.Len() != 4 {
+		t.Errorf("Len before Sweep = %d, want 4", m.Len())
+	}
+	if n := m.Sweep(); n != 3 {
+		t.Errorf("Sweep removed %d, want 3", n)
+	}
+	if m.Len() != 1 {
+		t.Errorf("Len after Sweep = %d, want 1", m.Len())
+	}
+}
+
+func TestTTLMapRefresh(t *testing.T) {
+	clock := newFakeClock()
+	m := NewTTLMap()
+	m.Clock = clock
+	m.Add("10.0.0.0/24", "ban", time.Minute)
+	m.Add("10.0.0.5", "ban", time.Hour)
+	if m.Len() != 3 {
+		t.Fatalf("Len = %d, want 3: %v", m.Len(), ttlString(m, clock))
+	}
+
+	// refreshing the /24 to the same expiry as the host ban merges them
+	clock.Advance(30 * time.Minute)
+	m.Add("10.0.0.0/24", "ban", 30*time.Minute)
+	want := []string{"[10.0.0.0, 10.0.0.255]=ban 30m0s"}
+	if got := ttlString(m, clock); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTTLMapRemove(t *testing.T) {
+	clock := newFakeClock()
+	m := NewTTLMap()
+	m.Clock = clock
+	m.Add("10.0.0.0/24", "ban", time.Hour)
+	if err := m.Remove("10.0.0.128/26"); err != nil {
+		t.Fatalf("Remove failed: %s", err)
+	}
+	want := []string{
+		"[10.0.0.0, 10.0.0.127]=ban 1h0m0s",
+		"[10.0.0.192, 10.0.0.255]=ban 1h0m0s",
+	}
+	if got := ttlString(m, clock); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := m.Remove("junk"); err == nil {
+		t.Errorf("Expected error on bad spec")
+	}
+	if err := m.Add("junk", "x", time.Hour); err == nil {
+		t.Errorf("Expected error on bad spec")
+	}
+	if err := m.AddRange(2, 1, "x", clock.Now()); err == nil {
+		t.Errorf("Expected error on reversed range")
+	}
+}
+
+func TestTTLMapWholeSpace(t *testing.T) {
+	clock := newFakeClock()
+	m := NewTTLMap()
+	m.Clock = clock
+	m.AddRange(0, 0xFFFFFFFF, "all", clock.Now().Add(time.Minute))
+	m.AddRange(0xFFFFFFFF, 0xFFFFFFFF, "last", clock.Now().Add(time.Hour))
+	m.AddRange(0, 0, "first", clock.Now().Add(time.Hour))
+	want := []string{
+		"[0.0.0.0, 0.0.0.0]=first 1h0m0s",
+		"[0.0.0.1, 255.255.255.254]=all 1m0s",
+		"[255.255.255.255, 255.255.255.255]=last 1h0m0s",
+	}
+	if got := ttlString(m, clock); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTTLMapSnapshot(t *testing.T) {
+	clock := newFakeClock()
+	m := NewTTLMap()
+	m.Clock = clock
+	m.Add("1.2.3.0/24", "net", 15*time.Minute)
+	m.Add("1.2.3.4", "host", time.Hour)
+	m.Add("5.6.7.8", "gone", time.Second)
+	clock.Advance(time.Second)
+
+	var buf bytes.Buffer
+	if err := m.WriteMMDB(&buf, MMDBWriter{DatabaseType: "ttl-test"}); err != nil {
+		t.Fatalf("WriteMMDB failed: %s", err)
+	}
+	db, err := NewMMDB(buf.Bytes())
+	if err != nil {
+		t.Fatalf("NewMMDB failed: %s", err)
+	}
+	restored := NewTTLMap()
+	restored.Clock = clock
+	if err := restored.LoadMMDB(db); err != nil {
+		t.Fatalf("LoadMMDB failed: %s", err)
+	}
+	if got, want := ttlString(restored, clock), ttlString(m, clock)[:3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("restored %v, want %v", got, want)
+	}
+
+	// snapshots only restore entries that are still live
+	clock.Advance(30 * time.Minute)
+	later := NewTTLMap()
+	later.Clock = clock
+	later.LoadMMDB(db)
+	if later.Len() != 1 || later.Contains("1.2.3.4") != "host" {
+		t.Errorf("late restore = %v", ttlString(later, clock))
+	}
+
+	// other databases are rejected
+	other := NewIntervalMap(0)
+	other.Add("1.2.3.4", "plain")
+	buf.Reset()
+	MMDBWriter{}.Write(&buf, other)
+	db, _ = NewMMDB(buf.Bytes())
+	if err := NewTTLMap().LoadMMDB(db); err == nil {
+		t.Errorf("Expected error loading a non-snapshot database")
+	}
+}
+
+func TestTTLMapSweeper(t *testing.T) {
+	m := NewTTLMap()
+	m.AddRange(1, 1, "x", time.Now().Add(-time.Second))
+	stop := m.StartSweeper(time.Millisecond)
+	defer stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sweeper did not run")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	stop()
+}
@@ -0,0 +1,242 @@
+package ipv4
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WebConfigFormat is an output format of WebConfigWriter
+type WebConfigFormat int
+
+// Web server and proxy formats
+const (
+	// NginxGeo is an nginx geo block setting a variable to each
+	// interval's value
+	NginxGeo WebConfigFormat = iota
+
+	// HAProxyMap is a map file of "network value" lines, for use with
+	// the map_ip converter
+	HAProxyMap
+
+	// HAProxyACL is a file of networks, for use with "acl name src -f"
+	HAProxyACL
+
+	// ApacheRequire is "Require ip" directives
+	ApacheRequire
+
+	// EnvoyRBAC is the rules of an Envoy RBAC filter in YAML, with one
+	// policy whose principals are the networks
+	EnvoyRBAC
+)
+
+// WebConfigWriter writes an IntervalMap as web server or proxy
+// configuration.
+//
+//	w := ipv4.WebConfigWriter{Format: ipv4.NginxGeo, Name: "country", Ranges: true}
+//	err := w.Write(os.Stdout, m)
+//
+// The nginx geo block and HAProxy map carry the interval values, the
+// other formats only list the networks selected by Match.
+type WebConfigWriter struct {
+	Format WebConfigFormat
+
+	// Name is the nginx variable (without "$") or the Envoy policy name,
+	// "blocklist" if empty
+	Name string
+
+	// Default is the nginx geo default value, none if empty
+	Default string
+
+	// Ranges writes nginx geo intervals as "first-last" ranges instead of
+	// CIDRs
+	Ranges bool
+
+	// Negate writes "Require not ip" for Apache, inside a <RequireAll>
+	// that grants everyone else since a negative Require can not stand
+	// alone
+	Negate bool
+
+	// Action is the Envoy RBAC action, "DENY" if empty
+	Action string
+
+	// PerLine is the most networks on an Apache Require line, 16 if 0
+	PerLine int
+
+	// Value formats interval values, fmt.Sprint if nil
+	Value func(value interface{}) string
+
+	// Match selects the intervals to write by value, nil writes all
+	Match func(value interface{}) bool
+}
+
+// Write writes the interval map to out
+func (wc WebConfigWriter) Write(out io.Writer, m *IntervalMap) error {
+	name := wc.Name
+	if name == "" {
+		name = "blocklist"
+	}
+	value := wc.Value
+	if value == nil {
+		value = func(v interface{}) string { return fmt.Sprint(v) }
+	}
+	var intervals []Interval
+	for _, val := range m.Intervals {
+		if wc.Match == nil || wc.Match(val.Value) {
+			intervals = append(intervals, val)
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	var err error
+	switch wc.Format {
+	case NginxGeo:
+		err = wc.writeNginxGeo(w, name, intervals, value)
+	case HAProxyMap:
+		err = writeHAProxyMap(w, intervals, value)
+	case HAProxyACL:
+		for _, p := range coalescedCIDRs(intervals) {
+			fmt.Fprintf(w, "%s\n", p)
+		}
+	case ApacheRequire:
+		wc.writeApacheRequire(w, coalescedCIDRs(intervals))
+	case EnvoyRBAC:
+		wc.writeEnvoyRBAC(w, name, coalescedCIDRs(intervals))
+	default:
+		err = fmt.Errorf("unknown web config format %d", wc.Format)
+	}
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// coalescedCIDRs returns the minimal networks of the intervals, ignoring
+// their values
+func coalescedCIDRs(intervals []Interval) []Prefix {
+	var prefixes []Prefix
+	for i := 0; i < len(intervals); {
+		j := i
+		for j+1 < len(intervals) && intervals[j].Right != 0xFFFFFFFF &&
+			intervals[j+1].Left == intervals[j].Right+1 {
+			j++
+		}
+		prefixes = appendCIDRs(prefixes, intervals[i].Left, intervals[j].Right)
+		i = j + 1
+	}
+	return prefixes
+}
+
+func (wc WebConfigWriter) writeNginxGeo(w *bufio.Writer, name string, intervals []Interval, value func(interface{}) string) error {
+	fmt.Fprintf(w, "geo $%s {\n", name)
+	if wc.Ranges {
+		fmt.Fprintf(w, "\tranges;\n")
+	}
+	if wc.Default != "" {
+		fmt.Fprintf(w, "\tdefault %s;\n", nginxQuote(wc.Default))
+	}
+	for _, val := range intervals {
+		v := value(val.Value)
+		if strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("value %q has a line break", v)
+		}
+		v = nginxQuote(v)
+		if wc.Ranges {
+			fmt.Fprintf(w, "\t%s-%s %s;\n", ToDots(val.Left), ToDots(val.Right), v)
+			continue
+		}
+		Interval2CIDRs(val.Left, val.Right, func(addr uint32, bits byte) {
+			fmt.Fprintf(w, "\t%s %s;\n", Prefix{Addr: addr, Bits: bits}, v)
+		})
+	}
+	fmt.Fprintf(w, "}\n")
+	return nil
+}
+
+// nginxQuote quotes a value if it is empty or has characters special to
+// the nginx config parser
+func nginxQuote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t;{}\"'\\#$") {
+		return s
+	}
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+	return `"` + s + `"`
+}
+
+func writeHAProxyMap(w *bufio.Writer, intervals []Interval, value func(interface{}) string) error {
+	for _, val := range intervals {
+		v := strings.TrimSpace(value(val.Value))
+		if v == "" || strings.ContainsAny(v, "\r\n") {
+			return fmt.Errorf("value %q can not be used in a map file", v)
+		}
+		Interval2CIDRs(val.Left, val.Right, func(addr uint32, bits byte) {
+			fmt.Fprintf(w, "%s %s\n", Prefix{Addr: addr, Bits: bits}, v)
+		})
+	}
+	return nil
+}
+
+func (wc WebConfigWriter) writeApacheRequire(w *bufio.Writer, prefixes []Prefix) {
+	perLine := wc.PerLine
+	if perLine <= 0 {
+		perLine = 16
+	}
+	directive := "Require ip"
+	if wc.Negate {
+		directive = "\tRequire not ip"
+		fmt.Fprintf(w, "<RequireAll>\n\tRequire all granted\n")
+		defer fmt.Fprintf(w, "</RequireAll>\n")
+	}
+	for len(prefixes) > 0 {
+		n := perLine
+		if n > len(prefixes) {
+			n = len(prefixes)
+		}
+		fmt.Fprintf(w, "%s", directive)
+		for _, p := range prefixes[:n] {
+			fmt.Fprintf(w, " %s", p)
+		}
+		fmt.Fprintf(w, "\n")
+		prefixes = prefixes[n:]
+	}
+}
+
+// writeEnvoyRBAC matches on direct_remote_ip, the peer address, rather
+// than remote_ip which may come from X-Forwarded-For
+func (wc WebConfigWriter) writeEnvoyRBAC(w *bufio.Writer, name string, prefixes []Prefix) {
+	action := wc.Action
+	if action == "" {
+		action = "DENY"
+	}
+	fmt.Fprintf(w, "action: %s\n", action)
+	if len(prefixes) == 0 {
+		// a policy needs at least one principal
+		fmt.Fprintf(w, "policies: {}\n")
+		return
+	}
+	fmt.Fprintf(w, "policies:\n  %s:\n    permissions:\n    - any: true\n    principals:\n", strconv.Quote(name))
+	for _, p := range prefixes {
+		fmt.Fprintf(w, "    - direct_remote_ip: {address_prefix: %q, prefix_len: %d}\n", ToDots(p.Addr), p.Bits)
+	}
+}
+
+// ParseWebConfigFormat returns the format named "nginx", "haproxy-map",
+// "haproxy-acl", "apache" or "envoy"
+func ParseWebConfigFormat(name string) (WebConfigFormat, error) {
+	switch strings.ToLower(name) {
+	case "nginx":
+		return NginxGeo, nil
+	case "haproxy-map":
+		return HAProxyMap, nil
+	case "haproxy-acl":
+		return HAProxyACL, nil
+	case "apache":
+		return ApacheRequire, nil
+	case "envoy":
+		return EnvoyRBAC, nil
+	}
+	return 0, fmt.Errorf("unknown web config format %q", name)
+}
@@ -0,0 +1,109 @@
+package ipv4
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// checkGolden compares got with testdata/name, or rewrites the file with
+// -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: expected\n%s\ngot\n%s", name, want, got)
+	}
+}
+
+func testWebConfigMap() *IntervalMap {
+	m := NewIntervalMap(10)
+	m.AddRange("10.0.0.0", "10.0.0.255", "US")
+	m.AddRange("10.0.1.0", "10.0.1.9", "CA")
+	m.AddRange("10.0.1.10", "10.0.1.255", "US")
+	m.AddRange("10.0.2.0", "10.0.3.255", "Cote d'Ivoire")
+	m.AddRange("192.0.2.7", "192.0.2.7", "-")
+	return m
+}
+
+func TestWebConfigWriter(t *testing.T) {
+	notDash := func(v interface{}) bool { return v != "-" }
+	cases := []struct {
+		golden string
+		wc     WebConfigWriter
+	}{
+		{"nginx_geo.golden", WebConfigWriter{Format: NginxGeo, Name: "country", Default: "ZZ"}},
+		{"nginx_geo_ranges.golden", WebConfigWriter{Format: NginxGeo, Name: "country", Ranges: true}},
+		{"haproxy.map.golden", WebConfigWriter{Format: HAProxyMap}},
+		{"haproxy.acl.golden", WebConfigWriter{Format: HAProxyACL, Match: notDash}},
+		{"apache.golden", WebConfigWriter{Format: ApacheRequire, Negate: true, PerLine: 1}},
+		{"apache_allow.golden", WebConfigWriter{Format: ApacheRequire, Match: notDash}},
+		{"envoy_rbac.golden", WebConfigWriter{Format: EnvoyRBAC, Match: notDash}},
+	}
+	for _, tt := range cases {
+		buf := bytes.Buffer{}
+		if err := tt.wc.Write(&buf, testWebConfigMap()); err != nil {
+			t.Errorf("%s: %s", tt.golden, err)
+			continue
+		}
+		checkGolden(t, tt.golden, buf.Bytes())
+	}
+}
+
+func TestWebConfigWriterErrors(t *testing.T) {
+	m := NewIntervalMap(1)
+	m.Add("10.0.0.0/24", "two\nlines")
+	buf := bytes.Buffer{}
+	for _, f := range []WebConfigFormat{NginxGeo, HAProxyMap} {
+		if err := (WebConfigWriter{Format: f}).Write(&buf, m); err == nil {
+			t.Errorf("format %d: expected error for line break in value", f)
+		}
+	}
+	if err := (WebConfigWriter{Format: 99}).Write(&buf, m); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+
+	buf.Reset()
+	if err := (WebConfigWriter{Format: EnvoyRBAC}).Write(&buf, NewIntervalMap(0)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "action: DENY\npolicies: {}\n" {
+		t.Errorf("unexpected empty policy: %q", buf.String())
+	}
+
+	for _, name := range []string{"nginx", "haproxy-map", "HAProxy-ACL", "apache", "envoy"} {
+		if _, err := ParseWebConfigFormat(name); err != nil {
+			t.Errorf("ParseWebConfigFormat(%q) failed: %s", name, err)
+		}
+	}
+	if _, err := ParseWebConfigFormat("caddy"); err == nil {
+		t.Errorf("expected error for caddy")
+	}
+}
+
+func TestNginxQuote(t *testing.T) {
+	cases := map[string]string{
+		"US":            "US",
+		"":              `""`,
+		"Cote d'Ivoire": `"Cote d'Ivoire"`,
+		`a"b\c`:         `"a\"b\\c"`,
+		"x;y":           `"x;y"`,
+	}
+	for in, want := range cases {
+		if got := nginxQuote(in); got != want {
+			t.Errorf("nginxQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}